@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -17,10 +18,8 @@ import (
 	"xelf.org/layla/pdf"
 	"xelf.org/layla/tsc"
 	"xelf.org/layla/tspl"
-	"xelf.org/xelf/exp"
 	"xelf.org/xelf/lib/extlib"
 	"xelf.org/xelf/lit"
-	"xelf.org/xelf/typ"
 )
 
 var rend = flag.String("rend", "tspl", "renderer")
@@ -49,6 +48,8 @@ func main() {
 	} else {
 		man.RegisterTTF("GoReg.ttf", "testdata/font/Go-Regular.ttf")
 		man.RegisterTTF("GoBold.ttf", "testdata/font/Go-Bold.ttf")
+		man.RegisterFamily("Go", font.Regular, "GoReg.ttf")
+		man.RegisterFamily("Go", font.Bold, "GoBold.ttf")
 	}
 	if err := man.Err(); err != nil {
 		log.Fatal("read font: ", err)
@@ -81,8 +82,11 @@ func main() {
 	if err != nil {
 		log.Fatal("read tmpl: ", err)
 	}
-	env := &exp.ArgEnv{Par: exp.Builtins(layla.Specs(reg).AddMap(extlib.Std)), Typ: typ.Dict, Val: &argmap}
-	node, err := layla.Eval(nil, reg, env, bytes.NewReader(tb), tmpl)
+	t, err := layla.NewTemplate(extlib.Std, bytes.NewReader(tb), tmpl)
+	if err != nil {
+		log.Fatal("parse tmpl: ", err)
+	}
+	node, err := t.Eval(context.Background(), &argmap)
 	if err != nil {
 		log.Fatal("exec tmpl: ", err)
 	}
@@ -95,14 +99,13 @@ func main() {
 		if *prnt != 0 {
 			pre = "SET KEY1 PRINT 1\nDENSITY 15"
 		}
-		err = tspl.Render(&buf, man, node, pre)
+		err = tspl.RenderCopies(&buf, man, node, *prnt, pre)
 		if err != nil {
 			log.Fatal("render: ", err)
 		}
 		if *prnt == 0 {
 			break
 		}
-		fmt.Fprintf(&buf, "PRINT %d\n", *prnt)
 		c, err := tsc.Auto(*dev, time.Second)
 		if err != nil {
 			log.Fatal(err)
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sync"
 
 	"xelf.org/xelf/exp"
 	"xelf.org/xelf/ext"
 	"xelf.org/xelf/lib"
 	"xelf.org/xelf/lit"
+	"xelf.org/xelf/typ"
 )
 
 // Eval parses and evaluates the label from reader r and returns a node or an error.
@@ -28,6 +30,90 @@ func Eval(ctx context.Context, reg *lit.Reg, env exp.Env, rr io.Reader, name str
 	return n, nil
 }
 
+// Template is a resolved label template that can be evaluated many times and concurrently.
+//
+// The template source is parsed, type checked and resolved against the parameter type once.
+// Resolved symbols are bound to their environment, so every template program has its own
+// argument environment, that is set to the argument for an evaluation. The programs are pooled
+// and only resolved again when more goroutines evaluate the template at the same time.
+// See BenchmarkTemplate for the cost of an evaluation.
+type Template struct {
+	Name  string
+	Param typ.Type
+	std   lib.Specs
+	x     exp.Exp
+	progs sync.Pool
+}
+
+// tmplProg is a resolved template expression with its own registry and argument environment.
+type tmplProg struct {
+	reg *lit.Reg
+	arg *exp.ArgEnv
+	x   exp.Exp
+}
+
+// NewTemplate parses and resolves the template from reader r with a dict parameter and returns
+// it or an error. The library specs std are added to the layla specs.
+func NewTemplate(std lib.Specs, r io.Reader, name string) (*Template, error) {
+	return NewParamTemplate(std, typ.Dict, r, name)
+}
+
+// NewParamTemplate parses and resolves the template from reader r with parameter type param
+// and returns it or an error. Unknown specs and type errors are reported here.
+func NewParamTemplate(std lib.Specs, param typ.Type, r io.Reader, name string) (*Template, error) {
+	x, err := exp.Read(&lit.Reg{}, r, name)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{Name: name, Param: param, std: std, x: x}
+	p, err := t.resolve()
+	if err != nil {
+		return nil, err
+	}
+	t.progs.Put(p)
+	return t, nil
+}
+
+// resolve returns a new template program resolved against the parameter type.
+func (t *Template) resolve() (*tmplProg, error) {
+	reg := &lit.Reg{}
+	arg := &exp.ArgEnv{Par: exp.Builtins(Specs(reg).AddMap(t.std)), Typ: t.Param}
+	x, err := exp.NewProg(context.Background(), reg, arg).Resl(arg, t.x.Clone(), typ.Any)
+	if err != nil {
+		return nil, fmt.Errorf("resolve template %s: %w", t.Name, err)
+	}
+	return &tmplProg{reg: reg, arg: arg, x: x}, nil
+}
+
+// Eval evaluates the template with the given arguments and returns a node or an error.
+// A nil arg is evaluated as empty dict. It is safe to call eval from multiple goroutines.
+func (t *Template) Eval(ctx context.Context, arg lit.Keyr) (*Node, error) {
+	if arg == nil {
+		arg = &lit.Dict{}
+	}
+	p, _ := t.progs.Get().(*tmplProg)
+	if p == nil {
+		var err error
+		if p, err = t.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		p.arg.Val = nil
+		t.progs.Put(p)
+	}()
+	p.arg.Val = arg
+	r, err := exp.NewProg(ctx, p.reg, p.arg).Eval(p.arg, p.x.Clone())
+	if err != nil {
+		return nil, err
+	}
+	n := ValNode(r.Val)
+	if n == nil {
+		return nil, fmt.Errorf("expected *layla.Node got %T", r)
+	}
+	return n, nil
+}
+
 func ValNode(v lit.Val) *Node {
 	if prx, ok := v.Value().(lit.Mut); ok {
 		if n, ok := prx.Ptr().(*Node); ok {
@@ -38,9 +124,12 @@ func ValNode(v lit.Val) *Node {
 }
 
 var listNodes = []string{"stage", "rect", "ellipse", "box", "vbox", "hbox", "table",
-	"page", "extra", "cover", "header", "footer"}
+	"page", "section", "toc", "extra", "cover", "header", "footer"}
 var dataNodes = []string{"line", "text", "markup", "qrcode", "barcode"}
 
+// Specs returns the layla node specs using registry reg.
+// Footnotes have no spec of their own. They are written inline as ^[note] in the data of text
+// and markup nodes, which also works with template arguments like (text 'Steel^[' $norm ']').
 func Specs(reg *lit.Reg) lib.Specs {
 	specs := make(lib.Specs, len(listNodes)+len(dataNodes))
 	for _, name := range listNodes {
@@ -62,6 +151,13 @@ func Specs(reg *lit.Reg) lib.Specs {
 					if c.Font == nil {
 						c.Font = o.Font
 					}
+					// stroke and text colors are inherited, fill colors are not
+					if c.Stroke == nil {
+						c.Stroke = o.Stroke
+					}
+					if c.Color == nil {
+						c.Color = o.Color
+					}
 					o.List = append(o.List, c)
 				}
 				return n.SetKey("list", v)
@@ -0,0 +1,201 @@
+package layla
+
+import (
+	"strconv"
+	"strings"
+)
+
+// fields holds the page numbers that are filled into page fields of text nodes.
+//
+// Page fields are written as µ{page}, µ{pages}, µ{sect} and µ{sects} for the page number, the
+// total number of pages, the page number within the current section and the number of pages in
+// the current section. An optional format can follow after a colon, as in µ{page:roman}.
+// Formats are arabic, roman, ROMAN, alpha, ALPHA or zeros for zero-padded numbers like 000.
+// The older µP and µT fields are the same as µ{page} and µ{pages}.
+//
+// Running fields are resolved from the content placed on a page. µ{first:name} and
+// µ{last:name} are the first and last text of nodes with that mark name on the page, and
+// µ{title} or µ{title:2} is the first heading of level one or two. Pages without a match use the
+// last value of the previous pages.
+type fields struct {
+	page, pages int
+	sect, sects int
+	note        int
+	first, last map[string]string
+}
+
+// sampleFields is used to measure text with page fields during layout.
+// Running fields without values are measured with a short sample text.
+var sampleFields = fields{28, 28, 28, 28, 28, nil, nil}
+
+// noteMark is the field used for footnote markers. The pager replaces it with the note number.
+const noteMark = "µ{note}"
+
+// replace returns s with all page fields replaced by their formatted value.
+func (f fields) replace(s string) string {
+	i := strings.Index(s, "µ")
+	if i < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i >= 0 {
+		b.WriteString(s[:i])
+		s = s[i+len("µ"):]
+		v, n := f.field(s)
+		if n == 0 {
+			b.WriteString("µ")
+		} else {
+			b.WriteString(v)
+			s = s[n:]
+		}
+		i = strings.Index(s, "µ")
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// field returns the formatted field value at the start of s and the consumed length or zero.
+func (f fields) field(s string) (string, int) {
+	if s == "" {
+		return "", 0
+	}
+	switch s[0] {
+	case 'P':
+		return strconv.Itoa(f.page), 1
+	case 'T':
+		return strconv.Itoa(f.pages), 1
+	case '{':
+	default:
+		return "", 0
+	}
+	end := strings.IndexByte(s, '}')
+	if end < 0 {
+		return "", 0
+	}
+	name, format := s[1:end], ""
+	if c := strings.IndexByte(name, ':'); c >= 0 {
+		name, format = name[:c], name[c+1:]
+	}
+	var v int
+	switch name {
+	case "page":
+		v = f.page
+	case "pages":
+		v = f.pages
+	case "sect":
+		v = f.sect
+	case "sects":
+		v = f.sects
+	case "note":
+		return "[" + formatNum(f.note, format) + "]", end + 1
+	case "first", "last", "title":
+		return f.mark(name, format), end + 1
+	default:
+		return "", 0
+	}
+	return formatNum(v, format), end + 1
+}
+
+// mark returns the running field value for name and the mark name or heading level arg.
+func (f fields) mark(name, arg string) string {
+	if f.first == nil {
+		return "MMMMMM"
+	}
+	switch name {
+	case "title":
+		if arg == "" {
+			arg = "1"
+		}
+		return f.first["#"+arg]
+	case "first":
+		return f.first[arg]
+	}
+	return f.last[arg]
+}
+
+// formatNum returns v formatted as arabic, roman, ROMAN, alpha, ALPHA or zero-padded number.
+func formatNum(v int, format string) string {
+	switch format {
+	case "roman":
+		return strings.ToLower(roman(v))
+	case "ROMAN":
+		return roman(v)
+	case "alpha":
+		return strings.ToLower(alpha(v))
+	case "ALPHA":
+		return alpha(v)
+	}
+	s := strconv.Itoa(v)
+	if strings.Trim(format, "0") == "" && len(s) < len(format) {
+		s = format[len(s):] + s
+	}
+	return s
+}
+
+var romans = []struct {
+	v int
+	s string
+}{
+	{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+	{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+}
+
+func roman(v int) string {
+	if v <= 0 {
+		return strconv.Itoa(v)
+	}
+	var b strings.Builder
+	for _, r := range romans {
+		for ; v >= r.v; v -= r.v {
+			b.WriteString(r.s)
+		}
+	}
+	return b.String()
+}
+
+// alpha returns v as letters A to Z followed by AA, AB and so on.
+func alpha(v int) string {
+	if v <= 0 {
+		return strconv.Itoa(v)
+	}
+	var res []byte
+	for ; v > 0; v = (v - 1) / 26 {
+		res = append([]byte{byte('A' + (v-1)%26)}, res...)
+	}
+	return string(res)
+}
+
+// splitNotes returns s with all inline footnotes written as ^[note] replaced by note markers
+// and the note texts.
+func splitNotes(s string) (string, []string) {
+	i := strings.Index(s, "^[")
+	if i < 0 {
+		return s, nil
+	}
+	var b strings.Builder
+	var notes []string
+	for i >= 0 {
+		depth, end := 0, -1
+		for j := i + 2; j < len(s) && end < 0; j++ {
+			switch s[j] {
+			case '[':
+				depth++
+			case ']':
+				if depth == 0 {
+					end = j
+				}
+				depth--
+			}
+		}
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		b.WriteString(noteMark)
+		notes = append(notes, s[i+2:end])
+		s = s[end+1:]
+		i = strings.Index(s, "^[")
+	}
+	b.WriteString(s)
+	return b.String(), notes
+}
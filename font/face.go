@@ -47,10 +47,13 @@ func PtToF(pt Pt) float64 {
 	return res
 }
 
+// Face is a font face used for layout. Name is the registered font name if the styler resolved
+// it from a font family, and add the width of fake bold strokes.
 type Face struct {
 	*Manager
 	font.Face
-	Add Dot
+	Add  Dot
+	Name string
 }
 
 func (f *Face) Extra() Dot { return f.Add }
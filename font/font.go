@@ -2,10 +2,15 @@ package font
 
 import (
 	"fmt"
+	"image"
+	"image/draw"
 	"io/ioutil"
+	"runtime"
+	"sync"
 
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
 )
 
 type Key struct {
@@ -19,16 +24,34 @@ type Src struct {
 	Name string
 }
 
+// Manager registers fonts and provides font faces for layout.
+// A manager and the faces it returns are safe for concurrent use.
 type Manager struct {
 	Compat bool
 	dpi    int
 	subx   int
 	suby   int
+	mu     sync.RWMutex
 	ttfs   map[string]*Src
 	faces  map[Key]font.Face
+	fams   map[string]family
+	icons  map[string]Icon
 	err    error
 }
 
+// Style selects a font of a font family.
+type Style uint8
+
+const (
+	Regular Style = iota
+	Bold
+	Italic
+	BoldItalic
+	Mono
+)
+
+type family [Mono + 1]string
+
 func NewManager(dpi, subx, suby int) *Manager {
 	return &Manager{dpi: dpi, subx: subx, suby: suby}
 }
@@ -53,36 +76,95 @@ func (m *Manager) SubPixels() (x, y int) {
 func (m *Manager) DotToPt(dot Dot) Pt { return PtF(float64(dot * Dot(m.DPI()) / (25.4 * 8))) }
 func (m *Manager) PtToDot(pt Pt) Dot  { return Dot(PtToF(pt)*25.4*8) / Dot(m.DPI()) }
 
-func (m *Manager) Err() error           { return m.err }
-func (m *Manager) fail(err error) error { m.err = err; return err }
+// Err returns the first error that occurred while registering fonts or icons using RegisterTTF
+// or RegisterIcon.
+func (m *Manager) Err() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
 
+// RegisterTTF registers the font file at path with name and returns the manager for chaining.
+// Errors are recorded and can be checked with Err. A failed registration does not affect
+// other fonts.
 func (m *Manager) RegisterTTF(name string, path string) *Manager {
-	if m.err != nil {
-		return m
+	m.record(m.AddTTF(name, path))
+	return m
+}
+
+func (m *Manager) record(err error) {
+	if err != nil {
+		m.mu.Lock()
+		if m.err == nil {
+			m.err = err
+		}
+		m.mu.Unlock()
 	}
+}
+
+// AddTTF registers the font file at path with name or returns an error.
+func (m *Manager) AddTTF(name string, path string) error {
+	m.mu.RLock()
 	_, ok := m.ttfs[name]
+	m.mu.RUnlock()
 	if ok {
-		return m
+		return nil
 	}
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		m.fail(fmt.Errorf("reading file %q: %v", path, err))
-		return m
+		return fmt.Errorf("reading file %q: %v", path, err)
 	}
 	f, err := truetype.Parse(data)
 	if err != nil {
-		m.fail(fmt.Errorf("parse file %q: %v", path, err))
-		return m
+		return fmt.Errorf("parse file %q: %v", path, err)
 	}
-	if m.ttfs == nil {
-		m.ttfs = make(map[string]*Src)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.ttfs[name]; !ok {
+		if m.ttfs == nil {
+			m.ttfs = make(map[string]*Src)
+		}
+		m.ttfs[name] = &Src{f, path, name}
 	}
-	m.ttfs[name] = &Src{f, path, name}
+	return nil
+}
+
+// RegisterFamily maps the style of the font family to the registered font name and returns the
+// manager for chaining.
+func (m *Manager) RegisterFamily(fam string, style Style, name string) *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fams == nil {
+		m.fams = make(map[string]family)
+	}
+	f := m.fams[fam]
+	f[style] = name
+	m.fams[fam] = f
 	return m
 }
 
+// Family returns the font name and style registered for the style of the font family or false.
+// Bold italic falls back to bold, and all styles fall back to regular.
+func (m *Manager) Family(fam string, style Style) (string, Style, bool) {
+	m.mu.RLock()
+	f, ok := m.fams[fam]
+	m.mu.RUnlock()
+	if !ok || style > Mono {
+		return "", Regular, false
+	}
+	if f[style] == "" && style == BoldItalic {
+		style = Bold
+	}
+	if f[style] == "" {
+		style = Regular
+	}
+	return f[style], style, f[style] != ""
+}
+
 func (m *Manager) Path(name string) (string, error) {
+	m.mu.RLock()
 	src, ok := m.ttfs[name]
+	m.mu.RUnlock()
 	if !ok {
 		return "", fmt.Errorf("unknown font %q", name)
 	}
@@ -90,28 +172,105 @@ func (m *Manager) Path(name string) (string, error) {
 }
 
 func (m *Manager) Face(name string, size float64) (font.Face, error) {
-	if m.err != nil {
-		return nil, m.err
-	}
 	key := Key{name, size}
+	m.mu.RLock()
 	f, ok := m.faces[key]
+	src, known := m.ttfs[name]
+	m.mu.RUnlock()
 	if ok {
 		return f, nil
 	}
-	src, ok := m.ttfs[name]
-	if !ok {
+	if !known {
 		return nil, fmt.Errorf("unknown font %q", name)
 	}
 	subx, suby := m.SubPixels()
-	f = truetype.NewFace(src.Font, &truetype.Options{
+	opts := &truetype.Options{
 		Size:       size,
 		DPI:        float64(m.DPI()),
 		SubPixelsX: subx,
 		SubPixelsY: suby,
-	})
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok = m.faces[key]; ok {
+		return f, nil
+	}
+	f = newPoolFace(src.Font, opts)
 	if m.faces == nil {
 		m.faces = make(map[Key]font.Face)
 	}
 	m.faces[key] = f
 	return f, nil
 }
+
+// poolFace is a font face that is safe for concurrent use. Truetype faces cache glyph data
+// and are not safe for concurrent use. Metric calls use faces from a bounded free list, that
+// unlike a sync pool is not cleared by the garbage collector. Glyphs are drawn by one face
+// guarded by a mutex and the mask is copied, because it is owned by the face.
+type poolFace struct {
+	new   func() font.Face
+	free  chan font.Face
+	mu    sync.Mutex
+	glyph font.Face
+	met   font.Metrics
+}
+
+func newPoolFace(f *truetype.Font, opts *truetype.Options) *poolFace {
+	p := &poolFace{free: make(chan font.Face, runtime.GOMAXPROCS(0))}
+	p.new = func() font.Face { return truetype.NewFace(f, opts) }
+	p.glyph = p.new()
+	p.met = p.glyph.Metrics()
+	return p
+}
+
+// get returns a face from the free list or a new face.
+func (p *poolFace) get() font.Face {
+	select {
+	case f := <-p.free:
+		return f
+	default:
+		return p.new()
+	}
+}
+
+// put returns face f to the free list or drops it if the list is full.
+func (p *poolFace) put(f font.Face) {
+	select {
+	case p.free <- f:
+	default:
+	}
+}
+
+func (p *poolFace) Close() error          { return nil }
+func (p *poolFace) Metrics() font.Metrics { return p.met }
+
+func (p *poolFace) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point, adv fixed.Int26_6, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dr, mask, maskp, adv, ok = p.glyph.Glyph(dot, r)
+	if !ok || mask == nil {
+		return dr, mask, maskp, adv, ok
+	}
+	cp := image.NewAlpha(image.Rectangle{Max: dr.Size()})
+	draw.Draw(cp, cp.Bounds(), mask, maskp, draw.Src)
+	return dr, cp, image.Point{}, adv, ok
+}
+
+func (p *poolFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, adv fixed.Int26_6, ok bool) {
+	f := p.get()
+	defer p.put(f)
+	return f.GlyphBounds(r)
+}
+
+func (p *poolFace) GlyphAdvance(r rune) (adv fixed.Int26_6, ok bool) {
+	f := p.get()
+	defer p.put(f)
+	return f.GlyphAdvance(r)
+}
+
+func (p *poolFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	f := p.get()
+	defer p.put(f)
+	return f.Kern(r0, r1)
+}
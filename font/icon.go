@@ -0,0 +1,88 @@
+package font
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Icon is a registered image file used inline in markup text.
+type Icon struct {
+	Name string
+	Path string
+	// W and H are the pixel dimensions of the image.
+	W, H int
+}
+
+// RegisterIcon registers the png or jpeg image file at path with name and returns the manager for
+// chaining. Errors are recorded and can be checked with Err.
+func (m *Manager) RegisterIcon(name string, path string) *Manager {
+	m.record(m.AddIcon(name, path))
+	return m
+}
+
+// RegisterIconDir registers all png and jpeg files in dir as icons named by their file name
+// without extension and returns the manager for chaining. Errors are recorded and can be
+// checked with Err.
+func (m *Manager) RegisterIconDir(dir string) *Manager {
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		m.record(fmt.Errorf("reading dir %q: %v", dir, err))
+		return m
+	}
+	for _, e := range es {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		switch strings.ToLower(ext) {
+		case ".png", ".jpg", ".jpeg":
+			if !e.IsDir() {
+				m.record(m.AddIcon(name[:len(name)-len(ext)], filepath.Join(dir, name)))
+			}
+		}
+	}
+	return m
+}
+
+// AddIcon registers the png or jpeg image file at path with name or returns an error.
+func (m *Manager) AddIcon(name string, path string) error {
+	if _, ok := m.Icon(name); ok {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("reading file %q: %v", path, err)
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return fmt.Errorf("decode image %q: %v", path, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return fmt.Errorf("empty image %q", path)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.icons[name]; !ok {
+		if m.icons == nil {
+			m.icons = make(map[string]Icon)
+		}
+		m.icons[name] = Icon{name, path, cfg.Width, cfg.Height}
+	}
+	return nil
+}
+
+// Icon returns the icon registered with name or false. File names like gluten.png also find
+// icons registered without extension, like those of RegisterIconDir.
+func (m *Manager) Icon(name string) (Icon, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ic, ok := m.icons[name]
+	if ext := filepath.Ext(name); !ok && ext != "" {
+		ic, ok = m.icons[name[:len(name)-len(ext)]]
+	}
+	return ic, ok
+}
@@ -1,14 +1,17 @@
 // Package html implements a layla renderer for html previews.
 // Both barcodes and qrcodes are generated as images and embedded as data urls.
+// Inline images and icons reference their file path.
 package html
 
 import (
 	"encoding/base64"
 	"fmt"
+	"html"
 	"image"
 	"image/png"
 	"log"
 	"math"
+	"path/filepath"
 	"strings"
 
 	"github.com/boombuler/barcode"
@@ -21,20 +24,15 @@ import (
 
 // Render renders the node n as HTML to b or returns an error.
 func Render(b bfr.Writer, man *font.Manager, n *layla.Node) error {
-	draw, err := layla.LayoutAndPage(man, n)
+	doc, err := layla.LayoutAndPage(man, n)
 	if err != nil {
 		return err
 	}
-	b.WriteString(`<style>
-@font-face {
-	font-family: 'GoReg.ttf';
-	src: url('font/Go-Regular.ttf') format('truetype');
-}
-@font-face {
-	font-family: 'GoBold.ttf';
-	src: url('font/Go-Bold.ttf') format('truetype');
-}
-.layla {
+	b.WriteString("<style>\n")
+	if err := writeFonts(b, man, doc.Draw()); err != nil {
+		return err
+	}
+	b.WriteString(`.layla {
 	position: relative;
 	background-color: white;
 	margin: 10mm;
@@ -46,87 +44,155 @@ func Render(b bfr.Writer, man *font.Manager, n *layla.Node) error {
 	box-sizing: border-box;
 }</style>
 `)
-	for i, d := range draw {
-		if i == 0 || d.Kind == "page" {
-			if i > 0 {
-				b.WriteString("</div>\n")
-			}
-			fmt.Fprintf(b, `<div class="layla" style="width:%gmm;height:%gmm">`+"\n", n.W/8, n.H/8)
-			if d.Kind == "page" {
+	for i, pg := range doc.Pages {
+		if i > 0 {
+			b.WriteString("</div>\n")
+		}
+		fmt.Fprintf(b, `<div class="layla" style="width:%gmm;height:%gmm">`+"\n", pg.W/8, pg.H/8)
+		for _, d := range pg.Draw {
+			if d.Kind == "bookmark" {
 				continue
 			}
-		}
-		b.WriteString(`<div style="`)
-		switch d.Kind {
-		case "ellipse":
-			writeBox(b, d.Box, d.Border.W)
-			fmt.Fprintf(b, "border:%gmm solid black;", d.Border.W/8)
-			b.WriteString(`border-radius: 50%">`)
-		case "line":
-			if d.W == 0 {
+			b.WriteString(`<div style="`)
+			style := d.Border.Stroke()
+			switch d.Kind {
+			case "ellipse":
 				writeBox(b, d.Box, d.Border.W)
-				fmt.Fprintf(b, "border-left:%gmm solid black;", d.Border.W/8)
-			} else if d.H == 0 {
+				fmt.Fprintf(b, "border:%gmm %s %s;", d.Border.W/8, style, color(d.Stroke))
+				writeFill(b, d.Fill)
+				b.WriteString(`border-radius: 50%">`)
+			case "line":
+				stroke := color(d.Stroke)
+				if d.W == 0 {
+					writeBox(b, d.Box, d.Border.W)
+					fmt.Fprintf(b, "border-left:%gmm %s %s;", d.Border.W/8, style, stroke)
+				} else if d.H == 0 {
+					writeBox(b, d.Box, d.Border.W)
+					fmt.Fprintf(b, "border-top:%gmm %s %s;", d.Border.W/8, style, stroke)
+				} else {
+					hyp := font.Dot(math.Sqrt(float64(d.W*d.W + d.H*d.H)))
+					deg := math.Asin(float64(d.H/hyp)) * 180 / math.Pi
+					pos := layla.Pos{d.X + d.Border.W*.25, d.Y - d.Border.W*.5}
+					if deg < 0 {
+						pos = layla.Pos{d.X - d.Border.W*.25, d.Y}
+					}
+					writeBox(b, layla.Box{pos, layla.Dim{hyp.Round(), 0}}, 0)
+					fmt.Fprintf(b, "border-top:%gmm %s %s;", d.Border.W/8, style, stroke)
+					fmt.Fprintf(b, "transform:rotate(%gdeg);", math.Round(deg*10)/10)
+					b.WriteString(`transform-origin:top left;`)
+				}
+				b.WriteString(`">`)
+			case "rect":
 				writeBox(b, d.Box, d.Border.W)
-				fmt.Fprintf(b, "border-top:%gmm solid black;", d.Border.W/8)
-			} else {
-				hyp := font.Dot(math.Sqrt(float64(d.W*d.W + d.H*d.H)))
-				deg := math.Asin(float64(d.H/hyp)) * 180 / math.Pi
-				pos := layla.Pos{d.X + d.Border.W*.25, d.Y - d.Border.W*.5}
-				if deg < 0 {
-					pos = layla.Pos{d.X - d.Border.W*.25, d.Y}
+				fmt.Fprintf(b, "border:%gmm %s %s;", d.Border.W/8, style, color(d.Stroke))
+				writeFill(b, d.Fill)
+				b.WriteString(`">`)
+			case "box":
+				writeBox(b, d.Box, d.Border.W)
+				if d.Border.W > 0 {
+					fmt.Fprintf(b, "border:%gmm %s %s;", d.Border.W/8, style, color(d.Stroke))
+				}
+				writeFill(b, d.Fill)
+				b.WriteString(`">`)
+			case "text":
+				y, fsize := d.Y+d.Font.Shift(), d.Font.Size
+				if man.Compat { // tspl render compatibility mode
+					// for some reason these parameters fit tspl label printer text rendering
+					y -= font.Dot(fsize * .55)
+					fsize *= .96
+				}
+				fmt.Fprintf(b, "left:%gmm;", (d.X-1)/8)
+				fmt.Fprintf(b, "top:%gmm;", y/8)
+				fmt.Fprintf(b, "width:%gmm;", d.W/8)
+				fmt.Fprintf(b, "height:%gmm;", d.H/8)
+				fmt.Fprintf(b, "font-family:'%s';", d.Font.FaceName())
+				fmt.Fprintf(b, "font-size:%gpt;", fsize)
+				fmt.Fprintf(b, "line-height:%gmm;", d.Font.Line/8)
+				if d.Font.Style&mark.Bold != 0 {
+					fmt.Fprintf(b, "font-weight:bold;")
+				}
+				switch st := d.Font.Style; {
+				case st&mark.Under != 0 && st&mark.Strike != 0:
+					b.WriteString("text-decoration:underline line-through;")
+				case st&mark.Under != 0:
+					b.WriteString("text-decoration:underline;")
+				case st&mark.Strike != 0:
+					b.WriteString("text-decoration:line-through;")
+				}
+				if d.Color != nil {
+					fmt.Fprintf(b, "color:%s;", color(d.Color))
+				}
+				writeFill(b, d.Fill)
+				if d.Border.W > 0 {
+					fmt.Fprintf(b, "border:%gmm %s %s;", d.Border.W/8, style, color(d.Stroke))
+				}
+				switch d.Align {
+				case 1:
+					fmt.Fprintf(b, "text-align:right;")
+				case 2:
+					fmt.Fprintf(b, "text-align:center;")
+				}
+				b.WriteString(`">`)
+				if d.Link != "" {
+					fmt.Fprintf(b, `<a href="%s">`, html.EscapeString(d.Link))
+				}
+				b.WriteString(strings.ReplaceAll(d.Data, "\n", "<br>\n"))
+				if d.Link != "" {
+					b.WriteString("</a>")
+				}
+			case "image":
+				writeBox(b, d.Box, 0)
+				b.WriteString(`">`)
+				src := d.Data
+				if ic, ok := man.Icon(d.Data); ok {
+					src = ic.Path
+				}
+				if d.Link != "" {
+					fmt.Fprintf(b, `<a href="%s">`, html.EscapeString(d.Link))
+				}
+				fmt.Fprintf(b, `<img style="width:%gmm;height:%gmm" src="%s" alt="">`,
+					d.W/8, d.H/8, html.EscapeString(src))
+				if d.Link != "" {
+					b.WriteString("</a>")
+				}
+			case "barcode", "qrcode":
+				writeBox(b, d.Box, 0)
+				b.WriteString(`">`)
+				err = writeBarcode(b, d)
+				if err != nil {
+					return err
 				}
-				writeBox(b, layla.Box{pos, layla.Dim{hyp.Round(), 0}}, 0)
-				fmt.Fprintf(b, "border-top:%gmm solid black;", d.Border.W/8)
-				fmt.Fprintf(b, "transform:rotate(%gdeg);", math.Round(deg*10)/10)
-				b.WriteString(`transform-origin:top left;`)
-			}
-			b.WriteString(`">`)
-		case "rect":
-			writeBox(b, d.Box, d.Border.W)
-			fmt.Fprintf(b, "border:%gmm solid black;", d.Border.W/8)
-			b.WriteString(`">`)
-		case "text":
-			y, fsize := d.Y, d.Font.Size
-			if man.Compat { // tspl render compatibility mode
-				// for some reason these parameters fit tspl label printer text rendering
-				y -= font.Dot(fsize * .55)
-				fsize *= .96
-			}
-			fmt.Fprintf(b, "left:%gmm;", (d.X-1)/8)
-			fmt.Fprintf(b, "top:%gmm;", y/8)
-			fmt.Fprintf(b, "width:%gmm;", d.W/8)
-			fmt.Fprintf(b, "height:%gmm;", d.H/8)
-			fmt.Fprintf(b, "font-family:'%s';", d.Font.Name)
-			fmt.Fprintf(b, "font-size:%gpt;", fsize)
-			fmt.Fprintf(b, "line-height:%gmm;", d.Font.Line/8)
-			if d.Font.Style&mark.Bold != 0 {
-				fmt.Fprintf(b, "font-weight:bold;")
-			}
-			if d.Border.W > 0 {
-				fmt.Fprintf(b, "border:%gmm solid black;", d.Border.W/8)
-			}
-			switch d.Align {
-			case 1:
-				fmt.Fprintf(b, "text-align:right;")
-			case 2:
-				fmt.Fprintf(b, "text-align:center;")
-			}
-			b.WriteString(`">`)
-			b.WriteString(strings.ReplaceAll(d.Data, "\n", "<br>\n"))
-		case "barcode", "qrcode":
-			writeBox(b, d.Box, 0)
-			b.WriteString(`">`)
-			err = writeBarcode(b, d)
-			if err != nil {
-				return err
 			}
+			b.WriteString("</div>\n")
 		}
-		b.WriteString("</div>\n")
 	}
 	b.WriteString(`</div>`)
 	return nil
 }
+
+// writeFonts writes a font face rule for every font face used by the draw nodes ns. The rules
+// use the font paths registered with the manager as url.
+func writeFonts(b bfr.Writer, man *font.Manager, ns []*layla.Node) error {
+	fs := make(map[string]bool, 8)
+	for _, n := range ns {
+		if n.Font == nil {
+			continue
+		}
+		name := n.Font.FaceName()
+		if fs[name] {
+			continue
+		}
+		path, err := man.Path(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "@font-face {\n\tfont-family: '%s';\n\tsrc: url('%s') format('truetype');\n}\n",
+			name, filepath.ToSlash(path))
+		fs[name] = true
+	}
+	return nil
+}
+
 func writeBox(b bfr.Writer, d layla.Box, border layla.Dot) {
 	fmt.Fprintf(b, "left:%gmm;", (d.X-border*.5)/8)
 	fmt.Fprintf(b, "top:%gmm;", (d.Y-border*.5)/8)
@@ -134,6 +200,20 @@ func writeBox(b bfr.Writer, d layla.Box, border layla.Dot) {
 	fmt.Fprintf(b, "height:%gmm;", (d.H+border)/8)
 }
 
+// color returns the css color for c, which defaults to black.
+func color(c *layla.Color) string {
+	if c == nil {
+		return "black"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func writeFill(b bfr.Writer, c *layla.Color) {
+	if c != nil {
+		fmt.Fprintf(b, "background-color:%s;", color(c))
+	}
+}
+
 func writeBarcode(b bfr.Writer, d *layla.Node) error {
 	img, err := bcode.Barcode(d)
 	if err != nil {
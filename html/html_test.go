@@ -0,0 +1,89 @@
+package html
+
+import (
+	"strings"
+	"testing"
+
+	"xelf.org/layla"
+	"xelf.org/layla/font"
+)
+
+func TestRender(t *testing.T) {
+	man := font.NewManager(72, 2, 4).RegisterTTF("", "../testdata/font/Go-Regular.ttf")
+	if err := man.Err(); err != nil {
+		t.Fatalf("register font error: %v", err)
+	}
+	box := layla.Box{Pos: layla.Pos{X: 8, Y: 16}, Dim: layla.Dim{W: 80, H: 40}}
+	red := &layla.Color{R: 255}
+	tests := []struct {
+		name string
+		node *layla.Node
+		want []string
+	}{
+		{"rect colors", &layla.Node{Kind: "rect", Box: box, Border: layla.Border{W: 2},
+			Stroke: red, Fill: &layla.Color{G: 128, B: 255}},
+			[]string{"border:0.25mm solid #ff0000;", "background-color:#0080ff;"}},
+		{"rect dotted", &layla.Node{Kind: "rect", Box: box,
+			Border: layla.Border{W: 2, Style: layla.StrokeDotted}},
+			[]string{"border:0.25mm dotted black;"}},
+		{"line dashed", &layla.Node{Kind: "line", Box: layla.Box{Dim: layla.Dim{W: 80}},
+			Border: layla.Border{W: 2, Dash: 8}},
+			[]string{"border-top:0.25mm dashed black;"}},
+		{"text color", &layla.Node{Kind: "text", Box: box, Color: red, Data: "A"},
+			[]string{"color:#ff0000;"}},
+		{"text reversed", &layla.Node{Kind: "text", Box: box, Rev: true, Data: "A"},
+			[]string{"color:#ffffff;background-color:#000000;"}},
+		{"rect reversed", &layla.Node{Kind: "rect", Box: box, Rev: true, List: []*layla.Node{
+			{Kind: "text", Data: "A"},
+		}}, []string{"background-color:#000000;", "color:#ffffff;"}},
+		{"markup decorations", &layla.Node{Kind: "markup", Box: box, Data: "++~~A~~++ ~~B~~"},
+			[]string{"text-decoration:underline line-through;", "text-decoration:line-through;"}},
+	}
+	for _, test := range tests {
+		n := &layla.Node{Kind: "stage", Box: layla.Box{Dim: layla.Dim{W: 400, H: 400}},
+			List: []*layla.Node{test.node}}
+		var b strings.Builder
+		if err := Render(&b, man, n); err != nil {
+			t.Errorf("%s render error: %v", test.name, err)
+			continue
+		}
+		got := b.String()
+		for _, w := range test.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s want %q in:\n%s", test.name, w, got)
+			}
+		}
+	}
+}
+
+func TestRenderFonts(t *testing.T) {
+	man := font.NewManager(72, 2, 4).
+		RegisterTTF("reg", "../testdata/font/Go-Regular.ttf").
+		RegisterTTF("bold", "../testdata/font/Go-Bold.ttf").
+		RegisterTTF("unused", "../testdata/font/Go-Regular.ttf").
+		RegisterFamily("go", font.Regular, "reg").
+		RegisterFamily("go", font.Bold, "bold")
+	if err := man.Err(); err != nil {
+		t.Fatalf("register font error: %v", err)
+	}
+	n := &layla.Node{Kind: "stage", Box: layla.Box{Dim: layla.Dim{W: 400, H: 400}},
+		Font: &layla.Font{Name: "go", Size: 8}, List: []*layla.Node{
+			{Kind: "markup", Data: "a *b*"},
+		}}
+	var b strings.Builder
+	if err := Render(&b, man, n); err != nil {
+		t.Fatalf("render error: %v", err)
+	}
+	got := b.String()
+	for _, w := range []string{
+		"font-family: 'reg';\n\tsrc: url('../testdata/font/Go-Regular.ttf')",
+		"font-family: 'bold';\n\tsrc: url('../testdata/font/Go-Bold.ttf')",
+	} {
+		if !strings.Contains(got, w) {
+			t.Errorf("want %q in:\n%s", w, got)
+		}
+	}
+	if strings.Contains(got, "'unused'") {
+		t.Errorf("want no rule for unused font in:\n%s", got)
+	}
+}
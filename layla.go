@@ -68,12 +68,36 @@ func (o *Off) Outset(b Box) Box {
 }
 
 // Font holds all font related node data
+// The name is either a registered font or font family. Face is the registered font resolved by
+// the styler and style holds the markup styles that renderers have to fake. Weight is bold or
+// normal and selects the weight of markup heading fonts, that default to bold.
 type Font struct {
 	Name   string   `json:"name,omitempty"`
 	Size   float64  `json:"size,omitempty"`
 	Line   Dot      `json:"line,omitempty"`
+	Weight string   `json:"weight,omitempty"`
 	Style  mark.Tag `json:"-"`
 	Height font.Pt  `json:"-"`
+	Face   string   `json:"-"`
+}
+
+// Shift returns the vertical offset that superscript and subscript text is drawn at.
+func (f *Font) Shift() Dot {
+	switch {
+	case f.Style&mark.Sup != 0:
+		return -(f.Line / 3).Floor()
+	case f.Style&mark.Sub != 0:
+		return (f.Line / 5).Floor()
+	}
+	return 0
+}
+
+// FaceName returns the registered font name to draw with.
+func (f *Font) FaceName() string {
+	if f.Face != "" {
+		return f.Face
+	}
+	return f.Name
 }
 
 // NodeLayout holds all layout related node data
@@ -93,18 +117,71 @@ type Code struct {
 	Wide  Dot    `json:"wide,omitempty"`
 }
 
+// Color is a simple rgb color with components ranging from 0 to 255.
 type Color struct {
 	R int `json:"r,omitempty"`
 	G int `json:"g,omitempty"`
 	B int `json:"b,omitempty"`
 }
 
+// White returns whether c is pure white. It is used to map colors for 1-bit renderers, where
+// any other color is printed black.
+func (c *Color) White() bool {
+	return c != nil && c.R >= 255 && c.G >= 255 && c.B >= 255
+}
+
+// Stroke styles used for borders and lines.
+const (
+	StrokeSolid  = "solid"
+	StrokeDashed = "dashed"
+	StrokeDotted = "dotted"
+)
+
+// Border holds the stroke widths and style of node borders and lines.
+// A custom dash pattern can be set with dash and space lengths and implies the dashed style.
 type Border struct {
-	W Dot `json:"w,omitempty"`
-	L Dot `json:"l,omitempty"`
-	T Dot `json:"t,omitempty"`
-	R Dot `json:"r,omitempty"`
-	B Dot `json:"b,omitempty"`
+	W     Dot    `json:"w,omitempty"`
+	L     Dot    `json:"l,omitempty"`
+	T     Dot    `json:"t,omitempty"`
+	R     Dot    `json:"r,omitempty"`
+	B     Dot    `json:"b,omitempty"`
+	Style string `json:"style,omitempty"`
+	Dash  Dot    `json:"dash,omitempty"`
+	Space Dot    `json:"space,omitempty"`
+}
+
+// Stroke returns the effective stroke style, that is either solid, dashed or dotted.
+func (b Border) Stroke() string {
+	switch {
+	case b.Dash > 0 || b.Style == StrokeDashed:
+		return StrokeDashed
+	case b.Style == StrokeDotted:
+		return StrokeDotted
+	}
+	return StrokeSolid
+}
+
+// Pattern returns the dash and space length for a stroke of width w or zero for solid strokes.
+func (b Border) Pattern(w Dot) (dash, space Dot) {
+	switch b.Stroke() {
+	case StrokeDashed:
+		if dash, space = b.Dash, b.Space; dash <= 0 {
+			dash, space = maxDot(4*w, 16), maxDot(2*w, 8)
+		} else if space <= 0 {
+			space = dash
+		}
+	case StrokeDotted:
+		dash = maxDot(w, 1)
+		space = maxDot(w, 2)
+	}
+	return dash, space
+}
+
+func maxDot(a, b Dot) Dot {
+	if a > b {
+		return a
+	}
+	return b
 }
 
 func (b Border) Default(w Dot) Border {
@@ -120,10 +197,95 @@ func (b Border) Default(w Dot) Border {
 	return b
 }
 
+// Table holds the table specific node data.
+// Head repeats the first row on each page and foot repeats the last row at the bottom of each
+// page. Carry uses the two rows before the footer as carried forward row, drawn at the bottom
+// of a page the table continues after, and brought forward row, drawn at the top of the next.
+// Text in those rows can refer to column sums with µS1 for the running sum of the first column
+// and µs1 for the sum of the current page only. Table rows are kept together unless split is set.
 type Table struct {
-	Cols []Dot `json:"cols,omitempty"`
-	Head bool  `json:"head,omitempty"`
-	Nobr bool  `json:"nobr,omitempty"`
+	Cols  []Dot `json:"cols,omitempty"`
+	Head  bool  `json:"head,omitempty"`
+	Foot  bool  `json:"foot,omitempty"`
+	Carry bool  `json:"carry,omitempty"`
+	Split bool  `json:"split,omitempty"`
+	Nobr  bool  `json:"nobr,omitempty"`
+}
+
+// tableParts returns the number of head, body and carry rows of table n with rows rows.
+// The rows are ordered head, body, carried and brought forward, and foot.
+func tableParts(n *Node, rows int) (head, body, carry int) {
+	if n.Head && rows > 0 {
+		head = 1
+	}
+	var foot int
+	if n.Foot && rows > head {
+		foot = 1
+	}
+	if n.Carry && rows >= head+foot+2 {
+		carry = 2
+	}
+	return head, rows - head - carry - foot, carry
+}
+
+// Flow holds all paging related node data.
+// Orphans and widows are the minimum number of text lines at the bottom of a page before
+// and at the top of a page after a break. Values set on the page node are used as default.
+// Keep moves the whole node to the next page instead of splitting it, and keep next does the
+// same for the node together with the start of its next sibling. The break flags start a new
+// page before or after the node.
+// Pages selects the pages of a header, footer or extra node and is one of odd, even, first or
+// last. A header or footer with a more specific selection is preferred. Skip lists page
+// numbers the node is suppressed on.
+// Level is the outline level of headings used for tables of contents and document outlines.
+// Mark names a running field that the text of the node is used for in headers and footers.
+// Size and land change the page size and orientation for the pages of a section.
+// Columns is the number of equal columns the page content flows into with the gutter space
+// between them. Sections can set their own columns and gutter, that default to the page values.
+type Flow struct {
+	Orphans     int    `json:"orphans,omitempty"`
+	Widows      int    `json:"widows,omitempty"`
+	Keep        bool   `json:"keep,omitempty"`
+	KeepNext    bool   `json:"keepnext,omitempty"`
+	BreakBefore bool   `json:"breakbefore,omitempty"`
+	BreakAfter  bool   `json:"breakafter,omitempty"`
+	Pages       string `json:"pages,omitempty"`
+	Skip        []int  `json:"skip,omitempty"`
+	Level       int    `json:"level,omitempty"`
+	Mark        string `json:"mark,omitempty"`
+	Size        Dim    `json:"size,omitempty"`
+	Land        bool   `json:"land,omitempty"`
+	Columns     int    `json:"columns,omitempty"`
+	Gutter      Dot    `json:"gutter,omitempty"`
+}
+
+// Markup holds the block markup node data.
+// Block lays out markup text as paragraphs, headings and rulers separated by blank lines instead
+// of one paragraph. Heads are the fonts of heading levels one to four, that default to bold and
+// scaled versions of the node font. Para is the space between blocks, that is increased by the
+// space before and after paragraphs and lists and the head space before and after headings.
+// Indent is the first line indent of paragraphs.
+// Links selects how link targets are printed for renderers without clickable links, either
+// text to append the target after the link text or qrcode to add qr codes below the text.
+type Markup struct {
+	Block bool    `json:"block,omitempty"`
+	Heads []*Font `json:"heads,omitempty"`
+	Para  Dot     `json:"para,omitempty"`
+	Links string  `json:"links,omitempty"`
+
+	Before     Dot `json:"before,omitempty"`
+	After      Dot `json:"after,omitempty"`
+	HeadBefore Dot `json:"headbefore,omitempty"`
+	HeadAfter  Dot `json:"headafter,omitempty"`
+	Indent     Dot `json:"indent,omitempty"`
+}
+
+// Entry is an outline entry for a heading with the page number and offset it was placed at.
+type Entry struct {
+	Level int
+	Title string
+	Page  int
+	Y     Dot
 }
 
 // Node is a part of the display tree and can represent any element.
@@ -133,9 +295,18 @@ type Node struct {
 	NodeLayout
 	Font   *Font   `json:"font,omitempty"`
 	Border Border  `json:"border,omitempty"`
+	Stroke *Color  `json:"stroke,omitempty"`
+	Fill   *Color  `json:"fill,omitempty"`
+	Color  *Color  `json:"color,omitempty"`
+	Rev    bool    `json:"rev,omitempty"`
 	List   []*Node `json:"list,omitempty"`
 	Table
+	Flow
+	Markup
 	Code *Code  `json:"code,omitempty"`
 	Data string `json:"data,omitempty"`
+	Link string `json:"link,omitempty"`
 	Calc Box    `json:"-"`
+	// Outline holds the entries listed by toc nodes.
+	Outline []Entry `json:"-"`
 }
@@ -1,8 +1,11 @@
 package layla
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"xelf.org/layla/font"
@@ -67,6 +70,7 @@ func TestLayla(t *testing.T) {
 		{`(vbox w:300 h:300 list:(list (text 'Hello') (text 'World')))`, "" +
 			`{kind:'text' w:300 h:40 font:{line:40} data:'Hello'}` +
 			`{kind:'text' y:40 w:300 h:40 font:{line:40} data:'World'}`},
+		{`(page w:200 h:200 (text 'A^[' 'Note' ']'))`, ""},
 		{`(page w:200 h:41 (text 'Page3'))`, "" +
 			`{kind:'text' w:97 h:40 font:{line:40} data:'Page3'}`},
 		{`(page w:200 h:41 (vbox (text 'Page1') (text 'Page2') (text 'Page3')))`, "" +
@@ -93,13 +97,13 @@ func TestLayla(t *testing.T) {
 		}
 
 		lay := &Layouter{man, 'i', FakeBoldStyler}
-		draw, err := lay.LayoutAndPage(n)
+		doc, err := lay.LayoutAndPage(n)
 		if err != nil {
 			t.Errorf("layout err: %v\n%v", err, n)
 			continue
 		}
 		var b strings.Builder
-		for _, d := range draw {
+		for _, d := range doc.Draw() {
 			dl, err := reg.Proxy(d)
 			if err != nil {
 				t.Errorf("could not proxy %v, error: %v", d, err)
@@ -112,6 +116,38 @@ func TestLayla(t *testing.T) {
 	}
 }
 
+func TestSpecsInherit(t *testing.T) {
+	reg := &lit.Reg{}
+	env := exp.Builtins(Specs(reg).AddMap(lib.Std))
+	raw := `(vbox stroke:[0 80 160] color:[160 0 0] fill:[255 230 200]` +
+		`(rect) (rect stroke:[0 0 0] color:[255 255 255]))`
+	n, err := Eval(nil, reg, env, strings.NewReader(raw), "")
+	if err != nil {
+		t.Fatalf("exec %s error: %v", raw, err)
+	}
+	if len(n.List) != 2 {
+		t.Fatalf("want 2 rects got %d", len(n.List))
+	}
+	tests := []struct {
+		stroke, color Color
+	}{
+		{Color{0, 80, 160}, Color{160, 0, 0}},
+		{Color{0, 0, 0}, Color{255, 255, 255}},
+	}
+	for i, test := range tests {
+		e := n.List[i]
+		if e.Stroke == nil || *e.Stroke != test.stroke {
+			t.Errorf("rect %d want stroke %v got %v", i, test.stroke, e.Stroke)
+		}
+		if e.Color == nil || *e.Color != test.color {
+			t.Errorf("rect %d want color %v got %v", i, test.color, e.Color)
+		}
+		if e.Fill != nil {
+			t.Errorf("rect %d want no inherited fill got %v", i, e.Fill)
+		}
+	}
+}
+
 func TestMeasure(t *testing.T) {
 	man := font.NewManager(72, 2, 4).RegisterTTF("", "testdata/font/Go-Regular.ttf")
 	if err := man.Err(); err != nil {
@@ -159,3 +195,75 @@ func TestMeasure(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := NewTemplate(lib.Std, strings.NewReader(`(stage w:360 h:360 (text $name))`), "test")
+	if err != nil {
+		t.Fatalf("parse template error: %v", err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 8; j++ {
+				name := fmt.Sprintf("Label %d.%d", i, j)
+				arg := &lit.Dict{Keyed: []lit.KeyVal{{Key: "name", Val: lit.Str(name)}}}
+				n, err := tmpl.Eval(context.Background(), arg)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if len(n.List) != 1 || n.List[0].Data != name {
+					errs[i] = fmt.Errorf("want text %q got %v", name, n.List)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("eval %d error: %v", i, err)
+		}
+	}
+}
+
+func TestTemplateResolve(t *testing.T) {
+	_, err := NewTemplate(lib.Std, strings.NewReader(`(stage w:360 h:360 (nospec $name))`), "test")
+	if err == nil {
+		t.Errorf("want resolve error for unknown spec")
+	}
+}
+
+func BenchmarkTemplate(b *testing.B) {
+	tmpl, err := NewTemplate(lib.Std, strings.NewReader(`(stage w:360 h:360 (text $name))`), "test")
+	if err != nil {
+		b.Fatalf("parse template error: %v", err)
+	}
+	arg := &lit.Dict{Keyed: []lit.KeyVal{{Key: "name", Val: lit.Str("Label")}}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tmpl.Eval(context.Background(), arg); err != nil {
+			b.Fatalf("eval error: %v", err)
+		}
+	}
+}
+
+// BenchmarkEval parses and resolves the template for every evaluation for comparison.
+func BenchmarkEval(b *testing.B) {
+	src := `(stage w:360 h:360 (text $name))`
+	arg := &lit.Dict{Keyed: []lit.KeyVal{{Key: "name", Val: lit.Str("Label")}}}
+	reg := &lit.Reg{}
+	env := exp.Builtins(Specs(reg).AddMap(lib.Std))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aenv := &exp.ArgEnv{Par: env, Typ: arg.Type(), Val: arg}
+		if _, err := Eval(context.Background(), reg, aenv, strings.NewReader(src), "test"); err != nil {
+			b.Fatalf("eval error: %v", err)
+		}
+	}
+}
@@ -29,12 +29,51 @@ func FakeBoldStyler(m *font.Manager, f Font, t mark.Tag) (*font.Face, error) {
 	return res, nil
 }
 
-func LayoutAndPage(m *font.Manager, n *Node) ([]*Node, error) {
-	l := &Layouter{m, 'X', ZeroStyler}
+// FamilyStyler returns a styler that selects the face for the markup style from the font family
+// registered with the manager. Bold is faked if the family has no bold face. Fonts that are no
+// family use the fallback styler.
+func FamilyStyler(fallback Styler) Styler {
+	return func(m *font.Manager, f Font, t mark.Tag) (*font.Face, error) {
+		name, s, ok := m.Family(f.Name, familyStyle(t))
+		if !ok {
+			return fallback(m, f, t)
+		}
+		ff, err := m.Face(name, f.Size)
+		if err != nil {
+			return nil, err
+		}
+		res := &font.Face{Manager: m, Face: ff, Name: name}
+		if t&mark.Bold != 0 && s != font.Bold && s != font.BoldItalic {
+			res.Add = 1
+		}
+		return res, nil
+	}
+}
+
+func familyStyle(t mark.Tag) font.Style {
+	switch {
+	case t&mark.Code != 0:
+		return font.Mono
+	case t&mark.Bold != 0 && t&mark.Italic != 0:
+		return font.BoldItalic
+	case t&mark.Bold != 0:
+		return font.Bold
+	case t&mark.Italic != 0:
+		return font.Italic
+	}
+	return font.Regular
+}
+
+func LayoutAndPage(m *font.Manager, n *Node) (*Document, error) {
+	l := &Layouter{m, 'X', FamilyStyler(ZeroStyler)}
 	return l.LayoutAndPage(n)
 }
 
-// Layouter implements the layout routine and holds required context
+// Layouter implements the layout routine and holds required context.
+//
+// A layouter can be used from multiple goroutines, as long as its styler is safe for concurrent
+// use, which all stylers in this package are. Layout stores the results in the nodes, so a node
+// tree must only be laid out by one goroutine at a time.
 type Layouter struct {
 	*font.Manager
 	Spacer rune
@@ -47,13 +86,51 @@ func (l *Layouter) Layout(n *Node) error {
 	return err
 }
 
-// LayoutAndPage layouts the node and returns a slice of nodes to draw or an error
-func (l *Layouter) LayoutAndPage(n *Node) ([]*Node, error) {
+// LayoutAndPage layouts the node and returns the paged document or an error.
+// Documents with toc nodes are laid out again with the outline from the previous pass until
+// the page numbers do not change.
+func (l *Layouter) LayoutAndPage(n *Node) (*Document, error) {
 	_, err := l.layout(n, n.Box, nil)
 	if err != nil {
 		return nil, err
 	}
-	return Page(n)
+	doc, err := Paginate(n)
+	tocs := findKind(n, "toc", nil)
+	for i := 0; err == nil && len(tocs) > 0 && i < 3; i++ {
+		if sameOutline(tocs[0].Outline, doc.Outline) {
+			break
+		}
+		for _, t := range tocs {
+			t.Outline = doc.Outline
+		}
+		if _, err = l.layout(n, n.Box, nil); err != nil {
+			return nil, err
+		}
+		doc, err = Paginate(n)
+	}
+	return doc, err
+}
+
+func findKind(n *Node, kind string, res []*Node) []*Node {
+	if n.Kind == kind {
+		res = append(res, n)
+	}
+	for _, e := range n.List {
+		res = findKind(e, kind, res)
+	}
+	return res
+}
+
+func sameOutline(a, b []Entry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, e := range a {
+		if e != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // layout sets the calculated absolute box inside the available bounds a and returns
@@ -78,7 +155,7 @@ func (l *Layouter) layout(n *Node, a Box, stack []*Node) (_ Box, err error) {
 	nb.H = clamp(ab.H, nb.H)
 	n.Calc = nb
 	switch n.Kind {
-	case "text":
+	case "text", "footnote":
 		err = l.lineLayout(n, stack)
 	case "markup":
 		err = l.lineLayout(n, stack)
@@ -101,12 +178,18 @@ func (l *Layouter) layout(n *Node, a Box, stack []*Node) (_ Box, err error) {
 	case "page":
 		n.Calc.H = 0
 		err = l.freeLayout(n, stack)
-	case "vbox":
+	case "vbox", "section":
+		// sections with another page size or columns use their column width
+		if w, ok := sectionWidth(n, stack); ok && n.W <= 0 {
+			n.Calc.W = w - m.L - m.R
+		}
 		err = l.vboxLayout(n, stack)
 	case "hbox":
 		err = l.hboxLayout(n, stack)
 	case "table":
 		err = l.tableLayout(n, stack)
+	case "toc":
+		err = l.tocLayout(n, stack)
 	}
 	if err != nil {
 		return Box{}, err
@@ -116,9 +199,19 @@ func (l *Layouter) layout(n *Node, a Box, stack []*Node) (_ Box, err error) {
 func (l *Layouter) freeLayout(n *Node, stack []*Node) error {
 	stack = append(stack, n)
 	a := n.Pad.Inset(n.Calc)
+	// page content is laid out with the column width
+	ca := a
+	if n.Kind == "page" {
+		ca.W = colWidth(a.W, n.Columns, n.Gutter)
+	}
 	var h Dot
 	for _, e := range n.List {
-		eb, err := l.layout(e, a, stack)
+		eb := ca
+		switch e.Kind {
+		case "extra", "cover", "header", "footer":
+			eb = a
+		}
+		eb, err := l.layout(e, eb, stack)
 		if err != nil {
 			return err
 		}
@@ -162,7 +255,8 @@ func (l *Layouter) vboxLayout(n *Node, stack []*Node) error {
 		h += y
 		if e.W > 0 {
 			e.Calc.W = e.W
-		} else {
+		} else if _, ok := sectionWidth(e, stack); !ok {
+			// sections with another page size or columns keep their own width
 			e.Calc.W = max
 		}
 	}
@@ -207,7 +301,11 @@ func (l *Layouter) tableLayout(n *Node, stack []*Node) error {
 	stack = append(stack, n)
 	tableCols(n)
 	a := n.Calc
+	head, body, carry := tableParts(n, len(tableRows(n)))
 	for i := 0; i < len(n.List); i += len(n.Cols) {
+		// carried and brought forward rows are placed by the pager
+		ri := i / len(n.Cols)
+		flow := ri < head+body || ri >= head+body+carry
 		r := n.List[i:]
 		if len(n.Cols) < len(r) {
 			r = r[:len(n.Cols)]
@@ -230,6 +328,9 @@ func (l *Layouter) tableLayout(n *Node, stack []*Node) error {
 		for _, c := range r {
 			c.Calc.H = rh
 		}
+		if !flow {
+			continue
+		}
 		rh += n.Gap
 		a.Y += rh
 		a.H -= rh
@@ -277,6 +378,46 @@ func clamp(a, c Dot) Dot {
 	return c
 }
 
+// sectionWidth returns the column width of section n in stack and whether it differs from the
+// column width of the page, because the section has another page size or columns.
+func sectionWidth(n *Node, stack []*Node) (Dot, bool) {
+	p := pageNode(stack)
+	if n.Kind != "section" || p == nil {
+		return 0, false
+	}
+	pc, pg := sectionCols(p, p)
+	pw := colWidth(p.Pad.Inset(Box{Dim: p.Dim}).W, pc, pg)
+	c, g := sectionCols(n, p)
+	w := colWidth(p.Pad.Inset(Box{Dim: sectionDim(n, p.Dim)}).W, c, g)
+	return w, w != pw
+}
+
+// columnWidth returns the column width of the nearest section or page in stack or zero.
+func columnWidth(stack []*Node) Dot {
+	p := pageNode(stack)
+	if p == nil {
+		return 0
+	}
+	for i := len(stack) - 1; i >= 0 && stack[i] != p; i-- {
+		if stack[i].Kind == "section" {
+			w, _ := sectionWidth(stack[i], stack)
+			return w
+		}
+	}
+	c, g := sectionCols(p, p)
+	return colWidth(p.Pad.Inset(p.Calc).W, c, g)
+}
+
+// pageNode returns the nearest page node in stack or nil.
+func pageNode(stack []*Node) *Node {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Kind == "page" {
+			return stack[i]
+		}
+	}
+	return nil
+}
+
 func getMargin(n *Node) Off {
 	var m Off
 	if n.Mar != nil {
@@ -20,14 +20,27 @@ const (
 	Head4
 	Ruler
 	Para
+	List
+	Item
+
+	Under
+	Strike
+	Sup
+	Sub
+	Attr
+	Image
 
 	Text   = Tag(0)
-	Style  = Bold | Italic | Code | Link
+	Style  = Bold | Italic | Code | Link | Under | Strike | Sup | Sub | Attr | Image
 	Header = Head1 | Head2 | Head3 | Head4
-	Block  = Ruler | Para
+	Block  = Ruler | Para | List | Item
 	All    = Style | Header | Block
 )
 
+// El is a markup element. Lists hold their items as elements, and items hold their marker as
+// content followed by the inline elements and nested lists. Links, images and attribute spans
+// hold the link target, image source or attributes as content and the inline elements of their
+// text.
 type El struct {
 	Tag  Tag
 	Cont string
@@ -40,8 +53,35 @@ func Inline(txt string) ([]El, error) { return All.Inline(txt) }
 func (tag Tag) Parse(txt string) (res []El, err error) {
 	var line string
 	var cont bool
+	var items []item
 	for len(txt) > 0 {
 		line, txt = readLine(txt)
+		if tag&List != 0 {
+			if ind, m, rest := listItem(line); m != "" {
+				els, err := tag.Inline(rest)
+				if err != nil {
+					return res, err
+				}
+				items = append(items, item{ind, El{Tag: Item, Cont: m, Els: els}})
+				continue
+			}
+			if len(items) > 0 {
+				if isCont(line) {
+					// lazy continuation lines belong to the last item
+					els, err := tag.Inline(strings.TrimSpace(line))
+					if err != nil {
+						return res, err
+					}
+					el := &items[len(items)-1].el
+					el.Els = append(el.Els, El{Cont: " "})
+					el.Els = append(el.Els, els...)
+					continue
+				}
+				res = append(res, lists(items)...)
+				items = nil
+				cont = false
+			}
+		}
 		var el *El
 		switch {
 		case tag&Header != 0 && strings.HasPrefix(line, "#"):
@@ -73,7 +113,9 @@ func (tag Tag) Parse(txt string) (res []El, err error) {
 				return res, err
 			}
 			if cont {
+				// lines of a paragraph are joined with a space
 				el = &res[len(res)-1]
+				el.Els = append(el.Els, El{Cont: " "})
 				el.Els = append(el.Els, els...)
 				continue
 			}
@@ -82,9 +124,77 @@ func (tag Tag) Parse(txt string) (res []El, err error) {
 		}
 		res = append(res, *el)
 	}
+	if len(items) > 0 {
+		res = append(res, lists(items)...)
+	}
 	return
 }
 
+type item struct {
+	indent int
+	el     El
+}
+
+// listItem returns the indent, marker and text of a list item line or an empty marker.
+// Items are marked with -, * or + for bullet lists or a number followed by a dot or parenthesis.
+func listItem(line string) (indent int, marker, rest string) {
+	for indent < len(line) && (line[indent] == ' ' || line[indent] == '\t') {
+		indent++
+	}
+	s := line[indent:]
+	n := 0
+	switch {
+	case len(s) > 1 && strings.IndexByte("-*+", s[0]) >= 0:
+		n = 1
+	default:
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		if n == 0 || n >= len(s) || s[n] != '.' && s[n] != ')' {
+			return indent, "", line
+		}
+		n++
+	}
+	if n >= len(s) || s[n] != ' ' {
+		return indent, "", line
+	}
+	return indent, s[:n], strings.TrimSpace(s[n:])
+}
+
+// isCont returns whether line continues the text of a list item.
+func isCont(line string) bool {
+	return strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") &&
+		!strings.HasPrefix(line, "---")
+}
+
+// lists returns list elements for items, where items with a deeper indent are nested in the
+// previous item.
+func lists(items []item) (res []El) {
+	for i := 0; i < len(items); {
+		var el El
+		el, i = nest(items, i)
+		res = append(res, el)
+	}
+	return res
+}
+
+func nest(items []item, i int) (El, int) {
+	ind := items[i].indent
+	list := El{Tag: List}
+	for i < len(items) && items[i].indent >= ind {
+		if items[i].indent > ind && len(list.Els) > 0 {
+			var sub El
+			sub, i = nest(items, i)
+			last := &list.Els[len(list.Els)-1]
+			last.Els = append(last.Els, sub)
+			continue
+		}
+		list.Els = append(list.Els, items[i].el)
+		i++
+	}
+	return list, i
+}
+
 func readLine(txt string) (line, rest string) {
 	end := strings.IndexByte(txt, '\n')
 	if end < 0 {
@@ -97,45 +207,37 @@ func readLine(txt string) (line, rest string) {
 	return
 }
 
+// Inline returns the inline elements of txt. Styled spans other than code, link texts and
+// attribute spans are parsed again, and nested spans are returned with the combined tags.
+// Spans are written as *bold*, _italic_, `code`, [link](url), ![alt](image), ++underline++,
+// ~~strike~~, ^superscript^ and ~subscript~. Attributes like {size=14 color=red} apply to the
+// next span or the text up to the next space or attribute span. Only size, font, color and
+// valign for images are attributes, other text in braces is kept as is.
 func (tag Tag) Inline(txt string) (res []El, _ error) {
 	var start, i int
 	for i < len(txt) {
-		c := rune(txt[i])
-		tag, end, ok := tag.inlineStart(c)
-		switch ok {
-		case true:
-			cont, n := consumeSpan(txt[i:], end, tag == Code)
-			if n == 0 {
-				break
-			}
-			var link string
-			var nn int
-			if tag == Link {
-				ii := i + n
-				ii += skipSpace(txt[ii:])
-				if ii >= len(txt) || txt[ii] != '(' {
-					break
-				}
-				link, nn = consumeSpan(txt[ii:], ')', false)
-				if nn == 0 {
-					break
-				}
-				nn += ii - i - n
-			}
+		st, cont, arg, n := tag.span(txt[i:])
+		if st == Attr && strings.HasSuffix(txt[:i], "µ") {
+			// page fields like µ{page} are no attributes
+			n = 0
+		}
+		if n > 0 {
 			if start < i {
-				cont := txt[start:i]
-				res = append(res, El{Cont: cont})
-			}
-			i += n + nn
-			el := El{Tag: tag, Cont: cont}
-			if tag == Link {
-				el.Els = []El{{Cont: el.Cont}}
-				el.Cont = link
+				res = append(res, El{Cont: txt[start:i]})
 			}
+			i += n
 			start = i
-			res = append(res, el)
+			switch st {
+			case Code:
+				res = append(res, El{Tag: st, Cont: cont})
+			case Link, Image, Attr:
+				els, _ := tag.Inline(cont)
+				res = append(res, El{Tag: st, Cont: arg, Els: els})
+			default:
+				els, _ := tag.Inline(cont)
+				res = append(res, withTag(els, st)...)
+			}
 			continue
-
 		}
 		i++
 		for _, c := range txt[i:] {
@@ -151,18 +253,115 @@ func (tag Tag) Inline(txt string) (res []El, _ error) {
 	return res, nil
 }
 
-func (tag Tag) inlineStart(c rune) (Tag, rune, bool) {
-	switch {
+// span returns the tag, content, link target or attributes and length of the span at the start
+// of txt or a zero length.
+func (tag Tag) span(txt string) (st Tag, cont, arg string, n int) {
+	st, end, ok := tag.inlineStart(txt)
+	if !ok {
+		return st, "", "", 0
+	}
+	open := len(end)
+	if st == Image {
+		open = 2
+	}
+	cont, n = consumeSpan(txt, open, end, st == Code)
+	if n == 0 {
+		return st, "", "", 0
+	}
+	switch st {
+	case Link, Image:
+		ii := n + skipSpace(txt[n:])
+		if ii >= len(txt) || txt[ii] != '(' {
+			return st, "", "", 0
+		}
+		link, nn := consumeSpan(txt[ii:], 1, ")", false)
+		if nn == 0 {
+			return st, "", "", 0
+		}
+		return st, cont, link, ii + nn
+	case Attr:
+		if !isAttrs(cont) {
+			return st, "", "", 0
+		}
+		rest := txt[n:]
+		m := strings.IndexFunc(rest, func(r rune) bool { return r == '{' || cor.Space(r) })
+		if sst, _, _, k := tag.span(rest); k > 0 && sst != Attr {
+			m = k
+		} else if m < 0 {
+			m = len(rest)
+		}
+		if m == 0 {
+			return st, "", "", 0
+		}
+		return st, rest[:m], cont, n + m
+	}
+	return st, cont, "", n
+}
+
+// attrKeys are the known attribute keys.
+var attrKeys = []string{"size", "font", "color", "valign"}
+
+// isAttrs returns whether s is a list of known key=value attributes. Other text in braces is
+// no attribute span and kept as text.
+func isAttrs(s string) bool {
+	fs := strings.Fields(s)
+	for _, f := range fs {
+		i := strings.IndexByte(f, '=')
+		if i <= 0 || i == len(f)-1 || !isAttrKey(f[:i]) {
+			return false
+		}
+	}
+	return len(fs) > 0
+}
+
+func isAttrKey(k string) bool {
+	for _, a := range attrKeys {
+		if k == a {
+			return true
+		}
+	}
+	return false
+}
+
+// withTag returns els with tag t added to all elements and link texts.
+func withTag(els []El, t Tag) []El {
+	for i := range els {
+		el := &els[i]
+		el.Tag |= t
+		if el.Tag&(Link|Image|Attr) != 0 {
+			el.Els = withTag(el.Els, t)
+		}
+	}
+	return els
+}
+
+func (tag Tag) inlineStart(txt string) (Tag, string, bool) {
+	if txt == "" {
+		return Text, "", false
+	}
+	switch c := txt[0]; {
 	case tag&Link != 0 && c == '[': // link
-		return Link, ']', true
+		return Link, "]", true
+	case tag&Image != 0 && strings.HasPrefix(txt, "!["): // image
+		return Image, "]", true
 	case tag&Bold != 0 && c == '*': // emphasis
-		return Bold, c, true
+		return Bold, "*", true
 	case tag&Italic != 0 && c == '_':
-		return Italic, c, true
+		return Italic, "_", true
 	case tag&Code != 0 && c == '`':
-		return Code, c, true
+		return Code, "`", true
+	case tag&Attr != 0 && c == '{':
+		return Attr, "}", true
+	case tag&Under != 0 && strings.HasPrefix(txt, "++"):
+		return Under, "++", true
+	case tag&Strike != 0 && strings.HasPrefix(txt, "~~"):
+		return Strike, "~~", true
+	case tag&Sup != 0 && c == '^':
+		return Sup, "^", true
+	case tag&Sub != 0 && c == '~':
+		return Sub, "~", true
 	}
-	return Text, 0, false
+	return Text, "", false
 }
 
 func skipSpace(s string) (n int) {
@@ -175,24 +374,31 @@ func skipSpace(s string) (n int) {
 	return
 }
 
-func consumeSpan(txt string, end rune, spok bool) (string, int) {
+// consumeSpan returns the content and length of the span at the start of txt with an opening
+// delimiter of length open and the end delimiter or zero. Brackets nest in link and image texts.
+func consumeSpan(txt string, open int, end string, spok bool) (string, int) {
 	var esc bool
+	var depth int
 	for i, r := range txt {
-		if i == 0 {
+		if i < open {
 			continue
 		}
-		if !spok && i == 1 && r == ' ' {
+		if !spok && i == open && r == ' ' {
 			break
 		}
 		if esc {
 			esc = false
 			continue
 		}
-		switch r {
-		case '\\':
+		switch {
+		case r == '\\':
 			esc = true
-		case end:
-			return txt[1:i], i + 1
+		case end == "]" && r == '[':
+			depth++
+		case end == "]" && r == ']' && depth > 0:
+			depth--
+		case strings.HasPrefix(txt[i:], end):
+			return txt[open:i], i + len(end)
 		}
 	}
 	return "", 0
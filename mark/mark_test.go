@@ -14,7 +14,7 @@ func TestParse(t *testing.T) {
 			{Tag: Para, Els: []El{{Cont: "test"}}},
 		}},
 		{"test\ntest", []El{
-			{Tag: Para, Els: []El{{Cont: "test"}, {Cont: "test"}}},
+			{Tag: Para, Els: []El{{Cont: "test"}, {Cont: " "}, {Cont: "test"}}},
 		}},
 		{"test\n\ntest", []El{
 			{Tag: Para, Els: []El{{Cont: "test"}}},
@@ -31,6 +31,67 @@ func TestParse(t *testing.T) {
 			{Tag: Head4, Cont: "title"},
 			{Tag: Para, Els: []El{{Cont: "test"}}},
 		}},
+		{"- one\n- two\n  more\n  1. a\n  2) b\n- three\n\ntest", []El{
+			{Tag: List, Els: []El{
+				{Tag: Item, Cont: "-", Els: []El{{Cont: "one"}}},
+				{Tag: Item, Cont: "-", Els: []El{{Cont: "two"}, {Cont: " "}, {Cont: "more"},
+					{Tag: List, Els: []El{
+						{Tag: Item, Cont: "1.", Els: []El{{Cont: "a"}}},
+						{Tag: Item, Cont: "2)", Els: []El{{Cont: "b"}}},
+					}},
+				}},
+				{Tag: Item, Cont: "-", Els: []El{{Cont: "three"}}},
+			}},
+			{Tag: Para, Els: []El{{Cont: "test"}}},
+		}},
+		{"*bold _and italic_* _[*a* b](url)_", []El{
+			{Tag: Para, Els: []El{
+				{Tag: Bold, Cont: "bold "},
+				{Tag: Bold | Italic, Cont: "and italic"},
+				{Cont: " "},
+				{Tag: Italic | Link, Cont: "url", Els: []El{
+					{Tag: Italic | Bold, Cont: "a"},
+					{Tag: Italic, Cont: " b"},
+				}},
+			}},
+		}},
+		{"++u++ ~~s *b*~~ m^2^ H~2~O", []El{
+			{Tag: Para, Els: []El{
+				{Tag: Under, Cont: "u"},
+				{Cont: " "},
+				{Tag: Strike, Cont: "s "},
+				{Tag: Strike | Bold, Cont: "b"},
+				{Cont: " m"},
+				{Tag: Sup, Cont: "2"},
+				{Cont: " H"},
+				{Tag: Sub, Cont: "2"},
+				{Cont: "O"},
+			}},
+		}},
+		{"{size=24 color=red}12{size=10},99 € {color=#ff0000}*sale now*", []El{
+			{Tag: Para, Els: []El{
+				{Tag: Attr, Cont: "size=24 color=red", Els: []El{{Cont: "12"}}},
+				{Tag: Attr, Cont: "size=10", Els: []El{{Cont: ",99"}}},
+				{Cont: " € "},
+				{Tag: Attr, Cont: "color=#ff0000", Els: []El{{Tag: Bold, Cont: "sale now"}}},
+			}},
+		}},
+		{"Flour ![gluten](gluten.png), *milk ![](milk)*!", []El{
+			{Tag: Para, Els: []El{
+				{Cont: "Flour "},
+				{Tag: Image, Cont: "gluten.png", Els: []El{{Cont: "gluten"}}},
+				{Cont: ", "},
+				{Tag: Bold, Cont: "milk "},
+				{Tag: Bold | Image, Cont: "milk"},
+				{Cont: "!"},
+			}},
+		}},
+		{"Step {1}. Price {EUR}12 {x=1}y {size=}z", []El{
+			{Tag: Para, Els: []El{{Cont: "Step {1}. Price {EUR}12 {x=1}y {size=}z"}}},
+		}},
+		{"µ{page}/µ{pages}", []El{
+			{Tag: Para, Els: []El{{Cont: "µ{page}/µ{pages}"}}},
+		}},
 		{"test [Link](url) *test* _test_ `  test   ` test", []El{
 			{Tag: Para, Els: []El{
 				{Cont: "test "},
@@ -1,160 +1,596 @@
 package layla
 
 import (
-	"fmt"
+	"strconv"
 	"strings"
+
+	"xelf.org/layla/mark"
 )
 
-func Page(n *Node) ([]*Node, error) {
+// Document is the paged result of a laid out node tree.
+type Document struct {
+	Pages []*Page
+	// Outline holds the entries of all headings in the document.
+	Outline []Entry
+}
+
+// Page is a document page with its zero based index, its size, the nodes to draw and the
+// source nodes that were placed on it.
+type Page struct {
+	Index int
+	Dim
+	Draw  []*Node
+	Nodes []*Node
+}
+
+// Draw returns the draw nodes of all pages separated by nodes of kind page.
+func (doc *Document) Draw() []*Node {
+	var res []*Node
+	for i, pg := range doc.Pages {
+		if i > 0 {
+			res = append(res, &Node{Kind: "page"})
+		}
+		res = append(res, pg.Draw...)
+	}
+	return res
+}
+
+// Paginate splits the laid out node n into pages and returns the document or an error.
+func Paginate(n *Node) (*Document, error) {
 	p := newPager(n)
 	err := p.collect(n)
 	if err != nil {
 		return nil, err
 	}
-	var res []*Node
-	total := fmt.Sprint(len(p.list))
+	p.lastPage()
+	doc := &Document{}
+	var pg *Page
+	f := fields{pages: p.npage}
+	carry := make(map[string]string)
 	for i, x := range p.list {
-		if i > 0 {
-			res = append(res, &Node{Kind: "page"})
-		}
-		x.page = fmt.Sprint(i + 1)
-		x.total = total
-		if p.Extra != nil {
-			res = x.collect(p.Extra, res, 0)
+		if x.col == 0 {
+			pg = &Page{Index: len(doc.Pages), Dim: x.dim}
+			doc.Pages = append(doc.Pages, pg)
+			f.page++
+			f.first, f.last = pageMarks(p.list[i:], carry)
+			carry = f.last
+			if i == 0 || x.sect {
+				f.sect, f.sects = 0, 1
+				for _, o := range p.list[i+1:] {
+					if o.col == 0 && o.sect {
+						break
+					}
+					if o.col == 0 {
+						f.sects++
+					}
+				}
+			}
+			f.sect++
+			for _, e := range p.Extra {
+				if onPage(e, f.page, f.pages) {
+					pg.Draw = collectTree(e, pg.Draw, 0)
+				}
+			}
+			_, top, bot := p.pageBox(f.page, f.pages, x.dim)
+			if top != nil {
+				pg.Draw = collectTree(top, pg.Draw, 0)
+			}
+			if bot != nil {
+				pg.Draw = collectTree(bot, pg.Draw, x.end)
+			}
 		}
-		top := p.Cover
-		if i > 0 {
-			top = p.Header
+		start := len(pg.Draw)
+		for _, d := range x.res {
+			d.X += x.offx
 		}
-		if top != nil {
-			res = x.collect(top, res, 0)
+		// footnotes are placed at the page box x, which already includes the column offset
+		x.res = x.collectNotes(x.res)
+		pg.Draw = append(pg.Draw, x.res...)
+		pg.Nodes = append(pg.Nodes, x.nodes...)
+		if x.col == 0 {
+			start = 0
 		}
-		if p.Footer != nil {
-			offy := x.Y + x.H
-			res = x.collect(p.Footer, res, offy)
+		for _, d := range pg.Draw[start:] {
+			switch d.Kind {
+			case "text":
+				d.Data = f.replace(d.Data)
+			case "bookmark":
+				doc.Outline = append(doc.Outline, Entry{Level: d.Level, Title: d.Data,
+					Page: f.page, Y: d.Y})
+			}
 		}
-		res = append(res, x.res...)
 	}
-	return res, nil
+	return doc, nil
 }
 
 type page struct {
 	Org Dot
 	Box
-	res   []*Node
-	page  string
-	total string
+	res  []*Node
+	head int
+	// col is the column index and offx the x offset of the column on a page with cols columns
+	col  int
+	cols int
+	offx Dot
+	// end is the bottom offset of the page content before the footer
+	end Dot
+	// dim is the page size
+	dim Dim
+	// nodes are the source nodes placed on the page
+	nodes []*Node
+	// marks are the running field values placed on the page
+	marks []pageMark
+	// notes are the numbered footnote draw nodes and noteH their height with the separator
+	notes []*Node
+	noteH Dot
+	// sect is whether the page starts a new section
+	sect bool
 }
 
 func collectCopy(n *Node) *Node {
-	d := &Node{Kind: n.Kind, Box: n.Calc, Border: n.Border}
+	d := &Node{Kind: n.Kind, Box: n.Calc, Border: n.Border, Stroke: n.Stroke, Fill: n.Fill}
 	d.Pad = n.Pad
+	d.Rev = n.Rev
+	if n.Rev {
+		// reversed nodes are drawn with a black fill and white text
+		d.Fill = &Color{}
+	}
 	switch n.Kind {
-	case "text":
+	case "text", "footnote":
 		d.Font = n.Font
+		d.Color = n.Color
+		if n.Rev {
+			d.Color = whiteColor()
+		}
 		d.Data = n.Data
+		d.Link = n.Link
 		d.Align = n.Align
 		d.Mar = n.Mar
+		d.Flow = n.Flow
 	case "qrcode", "barcode":
 		d.Code = n.Code
 		d.Data = n.Data
+	case "image":
+		d.Data = n.Data
+		d.Link = n.Link
 	}
 	return d
 }
 
-func (x *page) collect(n *Node, res []*Node, offy Dot) []*Node {
+func whiteColor() *Color { return &Color{R: 255, G: 255, B: 255} }
+
+// hasFill returns whether the container node n needs a background draw node.
+func hasFill(n *Node) bool { return n.Fill != nil || n.Rev }
+
+// fillCopy returns a box draw node for the background of a container node n.
+func fillCopy(n *Node) *Node {
+	d := collectCopy(n)
+	d.Kind = "box"
+	return d
+}
+
+// reverseText sets a white text color for all text draw nodes in res.
+// It is used for the content of reversed container nodes.
+func reverseText(res []*Node) {
+	for _, d := range res {
+		if d.Kind == "text" && !d.Rev {
+			d.Color = whiteColor()
+		}
+	}
+}
+
+// collectTree appends draw nodes for n and its children moved by offy to res and returns it.
+func collectTree(n *Node, res []*Node, offy Dot) []*Node {
 	var d *Node
 	switch n.Kind {
-	case "text":
-		d = collectCopy(n)
-		d.Data = strings.ReplaceAll(d.Data, "µP", x.page)
-		d.Data = strings.ReplaceAll(d.Data, "µT", x.total)
-	case "line", "qrcode", "barcode":
+	case "text", "line", "qrcode", "barcode", "image":
 		d = collectCopy(n)
 	case "rect", "ellipse":
 		d = collectCopy(n)
-		d.Y += offy
-		res = append(res, d)
-		fallthrough
-	case "stage", "box", "vbox", "hbox", "table", "page",
+	case "stage", "box", "vbox", "hbox", "toc", "section", "table", "page",
 		"extra", "cover", "header", "footer", "markup":
-		for _, e := range n.List {
-			res = x.collect(e, res, offy)
+		if hasFill(n) {
+			d = fillCopy(n)
 		}
-		return res
 	}
-	d.Y += offy
-	return append(res, d)
+	if d != nil {
+		d.Y += offy
+		res = append(res, d)
+	}
+	start := len(res)
+	for _, e := range n.List {
+		res = collectTree(e, res, offy)
+	}
+	if n.Rev {
+		reverseText(res[start:])
+	}
+	return res
 }
 
 type pager struct {
 	*Node
-	Extra  *Node
+	Extra  []*Node
 	Cover  *Node
-	Header *Node
-	Footer *Node
+	Header []*Node
+	Footer []*Node
 	THead  []*Node
+	TFoot  *tfoot
 	list   []*page
+	dim    Dim
+	cols   int
+	gutter Dot
+	npage  int
+	nnote  int
+	rev    int
+	brk    bool
+	// next is the node following the current container or its nearest ancestor with one.
+	next *Node
 }
 
 func newPager(n *Node) *pager {
-	p := &pager{Node: n}
+	p := &pager{Node: n, dim: n.Dim}
+	p.cols, p.gutter = sectionCols(n, n)
 	for _, e := range n.List {
 		switch e.Kind {
 		case "extra":
-			p.Extra = e
+			p.Extra = append(p.Extra, e)
 		case "cover":
 			p.Cover = e
 		case "header":
-			p.Header = e
+			p.Header = append(p.Header, e)
 		case "footer":
-			p.Footer = e
+			p.Footer = append(p.Footer, e)
 		}
 	}
 	p.newPage(0)
 	return p
 }
 
+// newPage starts a new page or the next column of the current page at offset org.
 func (p *pager) newPage(org Dot) *page {
-	b := p.Pad.Inset(Box{Dim: p.Dim})
-	top := p.Cover
-	if len(p.list) > 0 {
-		top = p.Header
+	var col, cols int
+	if p.Kind == "page" {
+		cols = p.cols
 	}
-	if top != nil {
-		h := top.Calc.H
-		b.Y += h
-		b.H -= b.Y
+	if n := len(p.list); n > 0 {
+		// continue in the next column of a page with the same size and columns
+		if l := p.list[n-1]; l.dim == p.dim && l.cols == cols && l.col+1 < cols {
+			col = l.col + 1
+		}
 	}
-	if p.Footer != nil {
-		b.H -= p.Footer.Calc.H
+	if col == 0 {
+		p.npage++
 	}
-	x := &page{Org: org, Box: b}
+	b, offx := p.colBox(col, cols)
+	f := p.TFoot
+	if f != nil && len(p.list) > 0 {
+		// finish the last page with the carried forward and footer rows
+		l := p.list[len(p.list)-1]
+		l.res = f.collect(l.res, f.carry, l.Y+l.H)
+		l.res = f.collect(l.res, f.foot, l.Y+l.H+rowBox(f.carry).H)
+		f.newPage()
+	}
+	x := &page{Org: org, Box: b, col: col, cols: cols, offx: offx, end: b.Y + b.H, dim: p.dim}
 	var mh Dot
 	for _, th := range p.THead {
 		if th.Calc.H > mh {
 			mh = th.Calc.H
 		}
-		x.res = x.collect(th, x.res, x.Y-th.Calc.Y)
+		x.res = collectTree(th, x.res, x.Y-th.Calc.Y)
 	}
 	if mh > 0 {
 		x.Y += mh
 		x.H -= mh
 	}
+	if f != nil {
+		x.res = f.collect(x.res, f.bring, x.Y)
+		bh := rowBox(f.bring).H
+		x.Y += bh
+		x.H -= bh + f.res
+	}
+	x.head = len(x.res)
 	p.list = append(p.list, x)
 	return x
 }
 
+// pageBox returns the content box with the header and footer for page k of total pages with
+// size dim. The cover is used as header of the first page.
+func (p *pager) pageBox(k, total int, dim Dim) (b Box, top, bot *Node) {
+	b = p.Pad.Inset(Box{Dim: dim})
+	if k == 1 {
+		top = p.Cover
+	} else {
+		top = pick(p.Header, k, total)
+	}
+	if top != nil {
+		h := top.Calc.H
+		b.Y += h
+		b.H -= b.Y
+	}
+	if bot = pick(p.Footer, k, total); bot != nil {
+		b.H -= bot.Calc.H
+	}
+	return b, top, bot
+}
+
+// lastPage moves the content of the last page to fit its header and footer if they differ
+// from the ones used while paging. If the content does not fit a new page is added.
+func (p *pager) lastPage() {
+	if p.Kind != "page" {
+		return
+	}
+	for {
+		k := p.npage
+		i := len(p.list) - 1
+		for p.list[i].col > 0 {
+			i--
+		}
+		xs := p.list[i:]
+		b, _, _ := p.pageBox(k, 0, xs[0].dim)
+		lb, _, _ := p.pageBox(k, k, xs[0].dim)
+		if b == lb {
+			return
+		}
+		dy, end := lb.Y-b.Y, lb.Y+lb.H
+		fits := true
+		for _, x := range xs {
+			for _, d := range x.res {
+				if d.Y+d.H+dy > end-x.noteH {
+					fits = false
+				}
+			}
+		}
+		if fits {
+			for _, x := range xs {
+				for _, d := range x.res {
+					d.Y += dy
+				}
+				x.end = end
+			}
+			return
+		}
+		org := xs[len(xs)-1].Org + xs[len(xs)-1].H
+		nx := p.newPage(org)
+		for nx.col > 0 {
+			nx = p.newPage(org)
+		}
+		// move the content that overlaps the last page footer to the new page
+		y := nx.Y
+		for _, x := range xs {
+			lim := end - x.noteH - dy
+			var moved []*Node
+			keep := x.res[:0]
+			for j, d := range x.res {
+				if j < x.head || d.Y+d.H <= lim {
+					keep = append(keep, d)
+					continue
+				}
+				if nd := p.splitText(d, lim); nd != nil {
+					keep = append(keep, d)
+					d = nd
+				}
+				moved = append(moved, d)
+			}
+			x.res = keep
+			if len(moved) == 0 {
+				continue
+			}
+			top := moved[0].Y
+			for _, d := range moved {
+				if d.Y < top {
+					top = d.Y
+				}
+			}
+			bot := y
+			for _, d := range moved {
+				d.Y += y - top
+				if d.Y+d.H > bot {
+					bot = d.Y + d.H
+				}
+			}
+			nx.res = append(nx.res, moved...)
+			y = bot
+		}
+	}
+}
+
+// splitText splits the lines of text draw node d that end below offset y into a new draw node
+// and returns it, or returns nil if d should be moved as a whole.
+func (p *pager) splitText(d *Node, y Dot) *Node {
+	if d.Kind != "text" || d.Rev || d.Font == nil || d.Font.Line <= 0 {
+		return nil
+	}
+	txt := strings.Split(d.Data, "\n")
+	var padh Dot
+	if d.Pad != nil {
+		padh = d.Pad.T + d.Pad.B
+	}
+	lh := d.Font.Line
+	lc := int((y - d.Y - padh) / lh)
+	if lc > 0 && lc < len(txt) {
+		orphans, widows := p.keepMin(d.Flow)
+		lc = keepLines(len(txt), lc, orphans, widows)
+	}
+	if lc <= 0 || lc >= len(txt) {
+		return nil
+	}
+	nd := *d
+	d.H = (lh*Dot(lc) + padh).Ceil()
+	d.Data = strings.Join(txt[:lc], "\n")
+	nd.Y = d.Y + d.H
+	nd.H = (lh*Dot(len(txt)-lc) + padh).Ceil()
+	nd.Data = strings.Join(txt[lc:], "\n")
+	return &nd
+}
+
+// pick returns the node in ns that is most specific for page k of total pages or nil.
+func pick(ns []*Node, k, total int) (res *Node) {
+	for _, n := range ns {
+		if onPage(n, k, total) && (res == nil || pageRank(n) > pageRank(res)) {
+			res = n
+		}
+	}
+	return res
+}
+
+// onPage returns whether node n applies to page k of total pages. Zero total pages means that
+// the last page is still unknown.
+func onPage(n *Node, k, total int) bool {
+	for _, s := range n.Skip {
+		if s == k {
+			return false
+		}
+	}
+	switch n.Pages {
+	case "":
+		return true
+	case "odd":
+		return k%2 == 1
+	case "even":
+		return k%2 == 0
+	case "first":
+		return k == 1
+	case "last":
+		return k == total
+	}
+	return false
+}
+
+func pageRank(n *Node) int {
+	switch n.Pages {
+	case "odd", "even":
+		return 1
+	case "first", "last":
+		return 2
+	}
+	return 0
+}
+
 func (p *pager) collect(n *Node) error {
+	if p.Kind == "page" {
+		if n.BreakBefore || p.brk {
+			p.brk = false
+			p.breakAt(n.Calc.Y)
+		}
+		if n.Keep {
+			p.keep(n)
+		}
+	}
+	err := p.collectNode(n)
+	p.landed(n)
+	if n.BreakAfter {
+		p.brk = true
+	}
+	return err
+}
+
+// landed records the source node n, its heading and running field marks for the pages it was
+// placed on.
+func (p *pager) landed(n *Node) {
+	if n.Kind != "page" {
+		x := p.pageAt(n.Calc.Y)
+		for _, o := range p.list {
+			if o == x || o.Org > n.Calc.Y && o.Org < n.Calc.Y+n.Calc.H {
+				o.nodes = append(o.nodes, n)
+			}
+		}
+	}
+	if n.Level > 0 {
+		p.bookmark(n)
+	}
+	if n.Mark != "" {
+		x := p.pageAt(n.Calc.Y)
+		x.marks = append(x.marks, pageMark{n.Mark, outlineTitle(n)})
+	}
+}
+
+// bookmark adds a bookmark draw node for heading n to the page it was placed on.
+func (p *pager) bookmark(n *Node) {
+	x := p.pageAt(n.Calc.Y)
+	y := n.Calc.Y
+	if p.Kind == "page" {
+		y += x.Y - x.Org
+	}
+	title := outlineTitle(n)
+	x.res = append(x.res, &Node{Kind: "bookmark", Data: title,
+		Box: Box{Pos: Pos{X: n.Calc.X, Y: y}}, Flow: Flow{Level: n.Level}})
+	x.marks = append(x.marks, pageMark{"#" + strconv.Itoa(n.Level), title})
+}
+
+// pageMark is a running field value with the mark name or heading level as key.
+type pageMark struct {
+	key, val string
+}
+
+// pageMarks returns the first and last mark values of the page starting with the first slot
+// in xs. Marks that are not on the page use the last value of the previous pages in carry.
+func pageMarks(xs []*page, carry map[string]string) (first, last map[string]string) {
+	first = make(map[string]string, len(carry))
+	last = make(map[string]string, len(carry))
+	for k, v := range carry {
+		first[k], last[k] = v, v
+	}
+	seen := make(map[string]bool)
+	for i, x := range xs {
+		if i > 0 && x.col == 0 {
+			break
+		}
+		for _, m := range x.marks {
+			if !seen[m.key] {
+				seen[m.key] = true
+				first[m.key] = m.val
+			}
+			last[m.key] = m.val
+		}
+	}
+	return first, last
+}
+
+// outlineTitle returns the plain text of the first text or markup node in n.
+func outlineTitle(n *Node) string {
 	switch n.Kind {
-	case "text", "line", "qrcode", "barcode":
-		p.draw(collectCopy(n), n.Mar)
+	case "text":
+		return strings.ReplaceAll(n.Data, "\n", " ")
+	case "markup":
+		els, err := mark.Inline(n.Data)
+		if err != nil {
+			return n.Data
+		}
+		var b strings.Builder
+		for _, el := range els {
+			b.WriteString(el.Cont)
+		}
+		return strings.Join(strings.Fields(b.String()), " ")
+	}
+	for _, e := range n.List {
+		if t := outlineTitle(e); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+func (p *pager) collectNode(n *Node) error {
+	switch n.Kind {
+	case "text", "line", "qrcode", "barcode", "image":
+		d := collectCopy(n)
+		if p.rev > 0 && n.Kind == "text" && !n.Rev {
+			d.Color = whiteColor()
+		}
+		if n.Kind == "text" && len(n.List) > 0 {
+			p.drawNotes(d, n.List)
+			return nil
+		}
+		p.draw(d, n.Mar)
 	case "rect", "ellipse":
+		if n.Rev {
+			p.keep(n)
+		}
 		p.draw(collectCopy(n), n.Mar)
-		return p.collectAll(n.List)
+		return p.collectList(n)
 	case "table":
-		if p.Kind == "page" && n.Nobr && !p.fits(n) {
-			p.newPage(n.Calc.Y)
+		if n.Nobr {
+			p.keep(n)
 		}
 		hh := n.Head && len(p.THead) == 0
 		if hh {
@@ -164,20 +600,84 @@ func (p *pager) collect(n *Node) error {
 			}
 			p.THead = head
 		}
-		err := p.collectAll(n.List)
+		err := p.collectRows(n)
 		if hh {
 			p.THead = nil
 		}
 		return err
-	case "stage", "box", "vbox", "hbox", "page", "markup":
+	case "stage", "box", "vbox", "hbox", "toc", "markup":
+		if n.Rev {
+			p.keep(n)
+		}
+		if hasFill(n) {
+			p.draw(fillCopy(n), n.Mar)
+		}
+		// block markup is collected block by block
+		block := n.Kind == "markup" && n.Block
+		if n.Kind == "markup" && !block && p.Kind == "page" {
+			p.keepMarkup(n)
+		}
+		if n.Kind == "markup" && !block && hasNotes(n) {
+			if n.Rev {
+				p.rev++
+				defer func() { p.rev-- }()
+			}
+			p.drawMarkupNotes(n)
+			return nil
+		}
+		return p.collectList(n)
+	case "section":
+		if p.Kind == "page" {
+			dim, cols, gutter := p.dim, p.cols, p.gutter
+			p.dim = sectionDim(n, p.Dim)
+			p.cols, p.gutter = sectionCols(n, p.Node)
+			if p.dim != dim || p.cols != cols || p.gutter != gutter {
+				// pages after a section with another size or columns start with the old ones
+				defer func() { p.dim, p.cols, p.gutter, p.brk = dim, cols, gutter, true }()
+			}
+			p.breakPage(n.Calc.Y)
+			x := p.pageAt(n.Calc.Y)
+			if x.dim != p.dim || x.cols != p.cols {
+				x = p.resize(x, n.Calc.Y)
+			}
+			x.sect = true
+		}
+		if hasFill(n) {
+			p.draw(fillCopy(n), n.Mar)
+		}
+		return p.collectList(n)
+	case "page":
 		return p.collectAll(n.List)
 	case "extra", "cover", "header", "footer":
 	}
 	return nil
 }
 
+// collectList collects the children of n and tracks whether they are part of a reversed region.
+func (p *pager) collectList(n *Node) error {
+	if n.Rev {
+		p.rev++
+		defer func() { p.rev-- }()
+	}
+	return p.collectAll(n.List)
+}
+
 func (p *pager) collectAll(ns []*Node) (err error) {
-	for _, e := range ns {
+	outer := p.next
+	defer func() { p.next = outer }()
+	for i, e := range ns {
+		p.next = outer
+		if i+1 < len(ns) {
+			p.next = ns[i+1]
+		}
+		if e.KeepNext && p.Kind == "page" {
+			if i+1 < len(ns) {
+				p.keepNext(ns[i:])
+			} else if outer != nil {
+				// the last child is kept with the node following its container
+				p.keepNext([]*Node{e, outer})
+			}
+		}
 		err := p.collect(e)
 		if err != nil {
 			return err
@@ -185,19 +685,474 @@ func (p *pager) collectAll(ns []*Node) (err error) {
 	}
 	return nil
 }
-func (p *pager) fits(n *Node) bool {
-	// check if case fits into the remaining space
-	for i := len(p.list) - 1; i >= 0; i-- {
-		x := p.list[i]
-		if x.Org > n.Calc.Y {
+
+// collectRows collects the table cells of n row by row. Rows are kept together or with the
+// next row if any of its cells has the keep flags set, and break before or after a row if any
+// of its cells has the break flags set.
+func (p *pager) collectRows(n *Node) error {
+	rows := tableRows(n)
+	head, body, carry := tableParts(n, len(rows))
+	var t *tfoot
+	if (n.Foot || n.Carry) && p.TFoot == nil {
+		t = newTfoot(n, rows[head+body:], carry)
+		p.TFoot = t
+		defer func() { p.TFoot = nil }()
+		// reserve space for the carried forward and footer rows on the current page
+		p.list[len(p.list)-1].H -= t.res
+	}
+	for i, r := range rows {
+		if i >= head+body && i < head+body+carry {
+			// carried and brought forward rows are drawn on page breaks
 			continue
 		}
-		y := n.Calc.Y - x.Org
-		return y+n.Calc.H <= x.H
+		if i >= head+body+carry && t != nil {
+			// the table ends on this page, so we draw the footer row in place
+			p.TFoot = nil
+			p.list[len(p.list)-1].H += t.res
+			p.keepBox(rowBox(r))
+			for _, d := range t.collect(nil, r, rowBox(r).Y) {
+				p.draw(d, nil)
+			}
+			break
+		}
+		var f Flow
+		for _, c := range r {
+			f.Keep = f.Keep || c.Keep
+			f.KeepNext = f.KeepNext || c.KeepNext
+			f.BreakBefore = f.BreakBefore || c.BreakBefore
+			f.BreakAfter = f.BreakAfter || c.BreakAfter
+		}
+		if p.Kind == "page" {
+			if f.BreakBefore {
+				p.breakAt(rowBox(r).Y)
+			}
+			if f.Keep || !n.Split {
+				p.keepBox(rowBox(r))
+			}
+			if f.KeepNext && i+1 < len(rows) {
+				b := rowBox(r)
+				nb := rowBox(rows[i+1])
+				b.H = nb.Y + nb.H - b.Y
+				p.keepBox(b)
+			}
+		}
+		if t != nil && i >= head {
+			t.add(r)
+		}
+		for _, c := range r {
+			if err := p.collectNode(c); err != nil {
+				return err
+			}
+			p.landed(c)
+		}
+		if f.BreakAfter {
+			p.brk = true
+		}
+	}
+	return nil
+}
+
+// tableRows returns the cells of table n split into rows.
+func tableRows(n *Node) (res [][]*Node) {
+	cols := len(n.Cols)
+	if cols == 0 {
+		cols = 1
+	}
+	for i := 0; i < len(n.List); i += cols {
+		r := n.List[i:]
+		if len(r) > cols {
+			r = r[:cols]
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// rowBox returns the box around all cells of row r.
+func rowBox(r []*Node) Box {
+	var b Box
+	for i, c := range r {
+		if i == 0 || c.Calc.Y < b.Y {
+			b.H += b.Y - c.Calc.Y
+			b.Y = c.Calc.Y
+		}
+		if h := c.Calc.Y + c.Calc.H - b.Y; h > b.H {
+			b.H = h
+		}
+	}
+	return b
+}
+
+// keep starts a new page at n if it does not fit into the remaining space of the current page.
+func (p *pager) keep(n *Node) {
+	p.keepBox(n.Calc)
+}
+
+// keepBox starts a new page at b if it does not fit into the remaining space of its page.
+// It does nothing if b already starts at the top of a page.
+func (p *pager) keepBox(b Box) {
+	if p.Kind != "page" {
+		return
+	}
+	x := p.pageAt(b.Y)
+	if x.Org < b.Y && b.Y-x.Org+b.H > x.H {
+		p.newPage(b.Y)
+	}
+}
+
+// keepNext keeps the first node in ns together with the start of the following nodes.
+// Consecutive nodes with the keep next flag are all kept together. Keep next has no effect
+// on a node without following nodes.
+func (p *pager) keepNext(ns []*Node) {
+	b := ns[0].Calc
+	for i := 1; i < len(ns); i++ {
+		e := ns[i]
+		end := e.Calc.Y + e.Calc.H
+		if !e.KeepNext || i == len(ns)-1 {
+			end = e.Calc.Y + firstHeight(e)
+		}
+		if end-b.Y > b.H {
+			b.H = end - b.Y
+		}
+		if !e.KeepNext {
+			break
+		}
+	}
+	p.keepBox(b)
+}
+
+// firstHeight returns the height of the part of n that is placed before any possible break.
+func firstHeight(n *Node) Dot {
+	if n.Keep || n.Rev || n.Nobr {
+		return n.Calc.H
+	}
+	var h Dot
+	switch n.Kind {
+	case "text":
+		if n.Font == nil || n.Font.Line <= 0 {
+			return n.Calc.H
+		}
+		lines := n.Orphans
+		if lines < 1 {
+			lines = 1
+		}
+		h = n.Font.Line * Dot(lines)
+		if n.Pad != nil {
+			h += n.Pad.T
+		}
+	case "markup":
+		if len(n.List) == 0 {
+			return n.Calc.H
+		}
+		c := n.List[0].Calc
+		if n.Block {
+			c.H = firstHeight(n.List[0])
+		}
+		h = c.Y + c.H - n.Calc.Y
+	case "table":
+		rows := tableRows(n)
+		if n.Head && len(rows) > 1 {
+			rows = rows[:2]
+		} else if len(rows) > 0 {
+			rows = rows[:1]
+		}
+		for _, r := range rows {
+			b := rowBox(r)
+			if end := b.Y + b.H - n.Calc.Y; end > h {
+				h = end
+			}
+		}
+	case "stage", "box", "vbox", "hbox", "section":
+		if len(n.List) == 0 {
+			return n.Calc.H
+		}
+		e := n.List[0]
+		h = e.Calc.Y - n.Calc.Y + firstHeight(e)
+	default:
+		return n.Calc.H
+	}
+	if h > n.Calc.H {
+		return n.Calc.H
+	}
+	return h
+}
+
+// breakAt starts a new page at offset y, unless the page at y already starts there or is empty.
+func (p *pager) breakAt(y Dot) {
+	x := p.pageAt(y)
+	if x.Org < y && len(x.res) > x.head {
+		p.newPage(y)
+	}
+}
+
+// resize changes the size and columns of the empty last page x to the current ones or starts a
+// new page at y if x is not empty.
+func (p *pager) resize(x *page, y Dot) *page {
+	if len(x.res) > 0 || x != p.list[len(p.list)-1] {
+		return p.newPage(y)
+	}
+	b, _ := p.colBox(0, p.cols)
+	x.Box, x.end, x.dim, x.cols = b, b.Y+b.H, p.dim, p.cols
+	return x
+}
+
+// colBox returns the content box and x offset of column col of cols columns on the current page.
+func (p *pager) colBox(col, cols int) (Box, Dot) {
+	// the last page is not known yet and checked after paging
+	b, _, _ := p.pageBox(p.npage, 0, p.dim)
+	if cols <= 1 {
+		return b, 0
+	}
+	b.W = colWidth(b.W, cols, p.gutter)
+	offx := Dot(col) * (b.W + p.gutter)
+	b.X += offx
+	return b, offx
+}
+
+// sectionCols returns the columns and gutter of section n with those of page p as default.
+func sectionCols(n, p *Node) (cols int, gutter Dot) {
+	cols, gutter = p.Columns, p.Gutter
+	if n.Columns > 0 {
+		cols = n.Columns
+	}
+	if n.Gutter > 0 {
+		gutter = n.Gutter
+	}
+	return cols, gutter
+}
+
+// colWidth returns the width of each of cols columns in width w with gutter space between them.
+func colWidth(w Dot, cols int, gutter Dot) Dot {
+	if cols <= 1 {
+		return w
+	}
+	return ((w - gutter*Dot(cols-1)) / Dot(cols)).Floor()
+}
+
+// sectionDim returns the page size of section n with the document page size d as default.
+func sectionDim(n *Node, d Dim) Dim {
+	if n.Size.W > 0 && n.Size.H > 0 {
+		d = n.Size
+	}
+	if n.Land && d.W < d.H {
+		d.W, d.H = d.H, d.W
+	}
+	return d
+}
+
+// breakPage is like breakAt but skips all remaining columns to start a new page.
+func (p *pager) breakPage(y Dot) {
+	p.breakAt(y)
+	for x := p.pageAt(y); x.col > 0; {
+		x = p.newPage(y)
+	}
+}
+
+// keepMin returns the minimum orphan and widow lines for f with the page values as default.
+func (p *pager) keepMin(f Flow) (orphans, widows int) {
+	if orphans = f.Orphans; orphans <= 0 {
+		orphans = p.Orphans
+	}
+	if widows = f.Widows; widows <= 0 {
+		widows = p.Widows
+	}
+	return orphans, widows
+}
+
+// keepLines returns how many of n lines to put before a page break, if only fit lines fit.
+// It returns fewer lines to leave enough widows and zero if the orphans would be too few.
+func keepLines(n, fit, orphans, widows int) int {
+	if fit >= n {
+		return n
+	}
+	if n-fit < widows {
+		fit = n - widows
+	}
+	if fit < orphans || fit < 0 {
+		fit = 0
+	}
+	return fit
+}
+
+// keepMarkup starts new pages between the lines of markup node n to respect the minimum
+// orphan and widow lines. The markup lines are made up of child nodes that overlap vertically.
+// Lines are always kept together, because their words can have different heights and offsets.
+func (p *pager) keepMarkup(n *Node) {
+	orphans, widows := p.keepMin(n.Flow)
+	var ls []Box
+	for _, e := range n.List {
+		if l := len(ls); l > 0 && e.Calc.Y < ls[l-1].Y+ls[l-1].H {
+			ls[l-1] = spanY(ls[l-1], e.Calc)
+		} else {
+			ls = append(ls, e.Calc)
+		}
+	}
+	for len(ls) > 0 {
+		x := p.pageAt(ls[0].Y)
+		fit := 0
+		for fit < len(ls) && ls[fit].Y-x.Org+ls[fit].H <= x.H {
+			fit++
+		}
+		if fit == len(ls) {
+			return
+		}
+		// we only move all lines to the next page if we are not at a page start
+		if kc := keepLines(len(ls), fit, orphans, widows); kc > 0 || x.Org < ls[0].Y {
+			fit = kc
+		} else if fit == 0 {
+			fit = 1
+		}
+		if fit >= len(ls) {
+			// a line taller than the page is placed by draw
+			return
+		}
+		p.newPage(ls[fit].Y)
+		ls = ls[fit:]
+	}
+}
+
+// spanY returns box a extended to the vertical extent of box b. Markup words of a line with
+// mixed font sizes overlap vertically but can start at different offsets.
+func spanY(a, b Box) Box {
+	if b.Y < a.Y {
+		a.H += a.Y - b.Y
+		a.Y = b.Y
+	}
+	if end := b.Y + b.H; end > a.Y+a.H {
+		a.H = end - a.Y
+	}
+	return a
+}
+
+// pageAt returns the last page that starts at or before offset y.
+func (p *pager) pageAt(y Dot) *page {
+	for i := len(p.list) - 1; i > 0; i-- {
+		if x := p.list[i]; x.Org <= y {
+			return x
+		}
+	}
+	return p.list[0]
+}
+
+// noteSep is the space above footnotes with the separator line.
+const noteSep Dot = 16
+
+// drawNotes draws text node d line by line and places the footnotes ns of each line on the
+// page the line lands on.
+func (p *pager) drawNotes(d *Node, ns []*Node) {
+	lines := strings.Split(d.Data, "\n")
+	lh := d.Font.Line
+	if len(lines) == 1 {
+		lh = d.H
+	}
+	b := d.Box
+	if d.Pad != nil {
+		b = d.Pad.Inset(b)
+	}
+	for i, txt := range lines {
+		ld := *d
+		ld.Pad = nil
+		ld.Box = Box{Pos: Pos{X: b.X, Y: b.Y + lh*Dot(i)}, Dim: Dim{W: b.W, H: lh}}
+		ld.Data = txt
+		c := strings.Count(txt, noteMark)
+		if c > len(ns) {
+			c = len(ns)
+		}
+		p.drawLine([]*Node{&ld}, ld.Box, ns[:c])
+		ns = ns[c:]
+	}
+}
+
+// drawMarkupNotes draws the word nodes of markup node n line by line and places the footnotes
+// of each line on the page the line lands on.
+func (p *pager) drawMarkupNotes(n *Node) {
+	for i := 0; i < len(n.List); {
+		b := n.List[i].Calc
+		var ds, ns []*Node
+		for ; i < len(n.List) && n.List[i].Calc.Y < b.Y+b.H; i++ {
+			e := n.List[i]
+			d := collectCopy(e)
+			if p.rev > 0 && !e.Rev {
+				d.Color = whiteColor()
+			}
+			b = spanY(b, e.Calc)
+			ds = append(ds, d)
+			ns = append(ns, e.List...)
+		}
+		p.drawLine(ds, b, ns)
+	}
+}
+
+// drawLine numbers the footnote markers in the line nodes ds and reserves space for the
+// footnotes ns at the bottom of the page the line box b lands on, before drawing the nodes.
+// It starts a new page if the line and the footnotes do not fit.
+func (p *pager) drawLine(ds []*Node, b Box, ns []*Node) {
+	var fs []*Node
+	var h Dot
+	for _, d := range ds {
+		for strings.Contains(d.Data, noteMark) && len(fs) < len(ns) {
+			p.nnote++
+			mark := fields{note: p.nnote}.replace(noteMark)
+			d.Data = strings.Replace(d.Data, noteMark, mark, 1)
+			fd := collectCopy(ns[len(fs)])
+			fd.Kind = "text"
+			fd.Data = strings.Replace(fd.Data, noteMark, mark, 1)
+			fs = append(fs, fd)
+			h += fd.H
+		}
+	}
+	if len(fs) > 0 {
+		x := p.pageAt(b.Y)
+		if p.Kind == "page" {
+			if x.Org < b.Y && b.Y-x.Org+b.H > x.H-x.noteSpace(h) {
+				x = p.newPage(b.Y)
+			}
+			h = x.noteSpace(h)
+			x.H -= h
+		}
+		x.notes = append(x.notes, fs...)
+		x.noteH += h
+	}
+	for _, d := range ds {
+		p.draw(d, nil)
+	}
+}
+
+// hasNotes returns whether any word node of markup node n has footnotes.
+func hasNotes(n *Node) bool {
+	for _, e := range n.List {
+		if len(e.List) > 0 {
+			return true
+		}
 	}
 	return false
 }
 
+// noteSpace returns the space needed for footnotes of height h including the separator.
+func (x *page) noteSpace(h Dot) Dot {
+	if len(x.notes) == 0 {
+		return h + noteSep
+	}
+	return h
+}
+
+// collectNotes appends the footnotes with a separator line at the bottom of the page to res.
+func (x *page) collectNotes(res []*Node) []*Node {
+	if len(x.notes) == 0 {
+		return res
+	}
+	y := x.end - x.noteH
+	res = append(res, &Node{Kind: "line", Box: Box{Pos: Pos{X: x.X, Y: y + noteSep/4}, Dim: Dim{W: x.W / 3}},
+		Border: Border{W: 2}})
+	y += noteSep
+	for _, d := range x.notes {
+		d.X, d.Y = x.X, y
+		y += d.H
+		res = append(res, d)
+	}
+	return res
+}
+
 func (p *pager) draw(n *Node, m *Off) {
 	if p.Kind != "page" {
 		xp := p.list[0]
@@ -219,13 +1174,27 @@ func (p *pager) draw(n *Node, m *Off) {
 		}
 		switch n.Kind {
 		case "text":
+			if n.Rev { // reversed text is kept together
+				break
+			}
 			txt := strings.Split(n.Data, "\n")
 			lh := n.Font.Line
 			ah := x.H - y
-			var hh Dot
-			for j := 0; len(txt) > 0; j++ {
+			orphans, widows := p.keepMin(n.Flow)
+			var top, hh Dot
+			if m != nil {
+				top = m.T
+			}
+			for len(txt) > 0 {
+				start := y <= top
 				lc := int(ah / lh)
-				if lc == 0 && j > 0 {
+				if lc < len(txt) {
+					// we only move all lines to the next page if we are not at a page start
+					if kc := keepLines(len(txt), lc, orphans, widows); kc > 0 || !start {
+						lc = kc
+					}
+				}
+				if lc == 0 && start {
 					lc = 1
 				}
 				if lc > len(txt) {
@@ -253,10 +1222,7 @@ func (p *pager) draw(n *Node, m *Off) {
 				} else {
 					x = p.newPage(n.Y + hh)
 				}
-				y = 0
-				if m != nil {
-					y = m.T
-				}
+				y = top
 				ah = x.H
 			}
 			return
@@ -275,3 +1241,160 @@ func (p *pager) draw(n *Node, m *Off) {
 		return
 	}
 }
+
+// tfoot holds the repeating footer rows and column sums of a table while it is paged.
+type tfoot struct {
+	carry, bring, foot []*Node
+	// res is the height reserved at the bottom of each page for the carry and foot rows
+	res       Dot
+	sum, page []float64
+	prec      []int
+	comma     bool
+}
+
+func newTfoot(n *Node, tail [][]*Node, carry int) *tfoot {
+	t := &tfoot{}
+	if carry > 0 {
+		t.carry, t.bring = tail[0], tail[1]
+		t.res += rowBox(t.carry).H + n.Gap
+	}
+	if len(tail) > carry {
+		t.foot = tail[carry]
+		t.res += rowBox(t.foot).H + n.Gap
+	}
+	t.sum = make([]float64, len(n.Cols))
+	t.page = make([]float64, len(n.Cols))
+	t.prec = make([]int, len(n.Cols))
+	return t
+}
+
+// add adds the numeric cell values of row r to the column sums.
+func (t *tfoot) add(r []*Node) {
+	for i, c := range r {
+		v, prec, comma, ok := parseNum(cellText(c))
+		if !ok || i >= len(t.sum) {
+			continue
+		}
+		t.sum[i] += v
+		t.page[i] += v
+		if prec > t.prec[i] {
+			t.prec[i] = prec
+		}
+		t.comma = t.comma || comma
+	}
+}
+
+// newPage resets the page sums.
+func (t *tfoot) newPage() {
+	for i := range t.page {
+		t.page[i] = 0
+	}
+}
+
+// collect appends draw nodes for row r at offset y to res with the column sums filled in.
+func (t *tfoot) collect(res []*Node, r []*Node, y Dot) []*Node {
+	if len(r) == 0 {
+		return res
+	}
+	start := len(res)
+	offy := y - rowBox(r).Y
+	for _, c := range r {
+		res = collectTree(c, res, offy)
+	}
+	for _, d := range res[start:] {
+		if d.Kind == "text" {
+			d.Data = t.replace(d.Data)
+		}
+	}
+	return res
+}
+
+// replace returns s with the running µS1 and page µs1 column sum placeholders replaced.
+func (t *tfoot) replace(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "µ")
+		if i < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i+len("µ"):]
+		j := 1
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+		if j > len(s) || s[0] != 'S' && s[0] != 's' {
+			b.WriteString("µ")
+			continue
+		}
+		col, err := strconv.Atoi(s[1:j])
+		if err != nil || col < 1 || col > len(t.sum) {
+			b.WriteString("µ")
+			continue
+		}
+		v := t.sum[col-1]
+		if s[0] == 's' {
+			v = t.page[col-1]
+		}
+		str := strconv.FormatFloat(v, 'f', t.prec[col-1], 64)
+		if t.comma {
+			str = strings.Replace(str, ".", ",", 1)
+		}
+		b.WriteString(str)
+		s = s[j:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// cellText returns the text data of the first text node in n.
+func cellText(n *Node) string {
+	if n.Kind == "text" {
+		return n.Data
+	}
+	for _, e := range n.List {
+		if s := cellText(e); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// parseNum parses a number like "1,234.50" or "1.234,50" and returns the value, the number of
+// decimal places and whether a decimal comma was used. The text must have exactly one field with
+// digits, that can have a unit or currency symbol attached. Other fields must be units without
+// digits like "12,50 EUR".
+func parseNum(s string) (v float64, prec int, comma, ok bool) {
+	var num string
+	for _, f := range strings.Fields(s) {
+		if strings.IndexAny(f, "0123456789") < 0 {
+			continue
+		}
+		if num != "" {
+			return 0, 0, false, false
+		}
+		num = strings.TrimFunc(f, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '-' && r != '.' && r != ','
+		})
+		if strings.TrimLeft(num, "0123456789-.,") != "" {
+			return 0, 0, false, false
+		}
+	}
+	dot, com := strings.LastIndexByte(num, '.'), strings.LastIndexByte(num, ',')
+	if com > dot && (dot >= 0 || len(num)-com-1 != 3) {
+		// a single comma followed by three digits is a thousands separator
+		comma = true
+		num = strings.ReplaceAll(num, ".", "")
+		num = strings.Replace(num, ",", ".", 1)
+	} else {
+		num = strings.ReplaceAll(num, ",", "")
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, 0, false, false
+	}
+	if i := strings.IndexByte(num, '.'); i >= 0 {
+		prec = len(num) - i - 1
+	}
+	return v, prec, comma, true
+}
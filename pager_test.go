@@ -0,0 +1,448 @@
+package layla
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"xelf.org/layla/font"
+)
+
+func drawString(draw []*Node) string {
+	var b strings.Builder
+	for _, d := range draw {
+		if d.Kind == "page" {
+			b.WriteString("|")
+			continue
+		}
+		fmt.Fprintf(&b, "{%s", d.Kind)
+		if d.X != 0 {
+			fmt.Fprintf(&b, " x:%g", d.X)
+		}
+		fmt.Fprintf(&b, " y:%g h:%g", d.Y, d.H)
+		if d.Data != "" {
+			fmt.Fprintf(&b, " %q", d.Data)
+		}
+		if d.Link != "" {
+			fmt.Fprintf(&b, " ->%s", d.Link)
+		}
+		b.WriteString("}")
+	}
+	return b.String()
+}
+
+func TestPager(t *testing.T) {
+	man := font.NewManager(72, 2, 4).RegisterTTF("", "testdata/font/Go-Regular.ttf").
+		RegisterIcon("gluten", "testdata/icon.png").RegisterIconDir("testdata")
+	if err := man.Err(); err != nil {
+		t.Fatalf("register font error: %v", err)
+	}
+	tests := []struct {
+		name string
+		node *Node
+		want string
+	}{
+		{"split text", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1"},
+				{Kind: "text", Data: "Page2\nPage3"},
+			}},
+		}}, `{text y:0 h:40 "Page1"}{text y:40 h:40 "Page2"}|{text y:0 h:40 "Page3"}`},
+		{"reverse text", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1"},
+				{Kind: "text", Data: "Page2\nPage3", Rev: true},
+			}},
+		}}, `{text y:0 h:40 "Page1"}|{text y:0 h:80 "Page2\nPage3"}`},
+		{"reverse rect", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1"},
+				{Kind: "rect", Box: Box{Dim: Dim{H: 80}}, Rev: true, List: []*Node{
+					{Kind: "text", Data: "Page2\nPage3"},
+				}},
+			}},
+		}}, `{text y:0 h:40 "Page1"}|{rect y:0 h:80}{text y:0 h:80 "Page2\nPage3"}`},
+		{"widows", &Node{Kind: "page", Box: Box{Dim: Dim{200, 130}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1"},
+				{Kind: "text", Data: "A\nB\nC", Flow: Flow{Widows: 2}},
+			}},
+		}}, `{text y:0 h:40 "Page1"}{text y:40 h:40 "A"}|{text y:0 h:80 "B\nC"}`},
+		{"orphans", &Node{Kind: "page", Box: Box{Dim: Dim{200, 130}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1\nPage1"},
+				{Kind: "text", Data: "A\nB\nC"},
+			}},
+		}, Flow: Flow{Orphans: 2}}, `{text y:0 h:80 "Page1\nPage1"}|{text y:0 h:120 "A\nB\nC"}`},
+		{"orphans at page start", &Node{Kind: "page", Box: Box{Dim: Dim{200, 50}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "A\nB\nC"},
+			}},
+		}, Flow: Flow{Orphans: 2}}, `{text y:0 h:40 "A"}|{text y:0 h:40 "B"}|{text y:0 h:40 "C"}`},
+		{"markup taller than page", &Node{Kind: "page", Box: Box{Dim: Dim{200, 60}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "{size=72}X"},
+			}},
+		}}, `{text y:0 h:243 "X"}`},
+		{"markup widows", &Node{Kind: "page", Box: Box{Dim: Dim{200, 130}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1"},
+				{Kind: "markup", Data: "A\nB\nC", Flow: Flow{Widows: 2}},
+			}},
+		}}, `{text y:0 h:40 "Page1"}{text y:40 h:40 "A"}|{text y:0 h:40 "B"}{text y:40 h:40 "C"}`},
+		{"keep", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1"},
+				{Kind: "vbox", Flow: Flow{Keep: true}, List: []*Node{
+					{Kind: "text", Data: "A"},
+					{Kind: "text", Data: "B"},
+				}},
+			}},
+		}}, `{text y:0 h:40 "Page1"}|{text y:0 h:40 "A"}{text y:40 h:40 "B"}`},
+		{"keep next", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1"},
+				{Kind: "text", Data: "Head", Flow: Flow{KeepNext: true}},
+				{Kind: "text", Data: "A\nB"},
+			}},
+		}}, `{text y:0 h:40 "Page1"}|{text y:0 h:40 "Head"}{text y:40 h:40 "A"}|{text y:0 h:40 "B"}`},
+		{"keep next last child", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "vbox", List: []*Node{
+					{Kind: "text", Data: "Page1"},
+					{Kind: "text", Data: "Head", Flow: Flow{KeepNext: true}},
+				}},
+				{Kind: "text", Data: "A"},
+			}},
+		}}, `{text y:0 h:40 "Page1"}|{text y:0 h:40 "Head"}{text y:40 h:40 "A"}`},
+		{"keep next without next", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Page1"},
+				{Kind: "text", Data: "A\nB", Flow: Flow{KeepNext: true}},
+			}},
+		}}, `{text y:0 h:40 "Page1"}{text y:40 h:40 "A"}|{text y:0 h:40 "B"}`},
+		{"break", &Node{Kind: "page", Box: Box{Dim: Dim{200, 200}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "A", Flow: Flow{BreakBefore: true}},
+				{Kind: "text", Data: "B", Flow: Flow{BreakAfter: true}},
+				{Kind: "text", Data: "C"},
+				{Kind: "text", Data: "D", Flow: Flow{BreakBefore: true}},
+			}},
+		}}, `{text y:0 h:40 "A"}{text y:40 h:40 "B"}|{text y:0 h:40 "C"}|{text y:0 h:40 "D"}`},
+		{"table rows", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "table", Table: Table{Cols: []Dot{100, 100}}, List: []*Node{
+				{Kind: "text", Data: "A"}, {Kind: "text", Data: "B"},
+				{Kind: "text", Data: "C"}, {Kind: "text", Data: "D\nE"},
+			}},
+		}}, `{text y:0 h:40 "A"}{text x:100 y:0 h:40 "B"}|{text y:0 h:80 "C"}{text x:100 y:0 h:80 "D\nE"}`},
+		{"table split", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "table", Table: Table{Cols: []Dot{100, 100}, Split: true}, List: []*Node{
+				{Kind: "text", Data: "A"}, {Kind: "text", Data: "B"},
+				{Kind: "text", Data: "C"}, {Kind: "text", Data: "D\nE"},
+			}},
+		}}, `{text y:0 h:40 "A"}{text x:100 y:0 h:40 "B"}{text y:40 h:40 "C"}{text x:100 y:40 h:40 "D"}|{text x:100 y:0 h:40 "E"}`},
+		{"table sums", &Node{Kind: "page", Box: Box{Dim: Dim{200, 200}}, List: []*Node{
+			{Kind: "table", Table: Table{Cols: []Dot{200}, Foot: true, Carry: true}, List: []*Node{
+				{Kind: "text", Data: "1,50"},
+				{Kind: "text", Data: "2,25"},
+				{Kind: "text", Data: "3"},
+				{Kind: "text", Data: "4"},
+				{Kind: "text", Data: "c µS1"},
+				{Kind: "text", Data: "b µS1"},
+				{Kind: "text", Data: "f µs1"},
+			}},
+		}}, `{text y:0 h:40 "1,50"}{text y:40 h:40 "2,25"}{text y:80 h:40 "3"}{text y:120 h:40 "c 6,75"}{text y:160 h:40 "f 6,75"}|` +
+			`{text y:0 h:40 "b 6,75"}{text y:40 h:40 "4"}{text y:80 h:40 "f 4,00"}`},
+		{"fields", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "section", List: []*Node{
+					{Kind: "text", Data: "µ{page}/µ{pages}"},
+					{Kind: "text", Data: "µ{sect:roman}/µ{sects:ROMAN}"},
+					{Kind: "text", Data: "µ{sect:000}"},
+				}},
+				{Kind: "section", List: []*Node{
+					{Kind: "markup", Data: "µ{sect:alpha} µP/µT"},
+				}},
+			}},
+		}}, `{text y:0 h:40 "1/3"}{text y:40 h:40 "i/II"}|{text y:0 h:40 "002"}|` +
+			`{text y:0 h:40 "a"}{text x:45 y:0 h:40 "3/3"}`},
+		{"columns", &Node{Kind: "page", Box: Box{Dim: Dim{220, 100}},
+			Flow: Flow{Columns: 2, Gutter: 20}, List: []*Node{
+				{Kind: "vbox", List: []*Node{
+					{Kind: "text", Data: "A\nB\nC\nD\nE"},
+				}},
+			}}, `{text y:0 h:80 "A\nB"}{text x:120 y:0 h:80 "C\nD"}|{text y:0 h:40 "E"}`},
+		{"section columns", &Node{Kind: "page", Box: Box{Dim: Dim{220, 100}},
+			Flow: Flow{Columns: 2, Gutter: 20}, List: []*Node{
+				{Kind: "vbox", List: []*Node{
+					{Kind: "text", Data: "A"},
+					{Kind: "section", Flow: Flow{Columns: 1}, List: []*Node{
+						{Kind: "text", Data: "B\nC\nD"},
+					}},
+					{Kind: "section", Flow: Flow{Size: Dim{420, 100}, Gutter: 40}, List: []*Node{
+						{Kind: "text", Data: "E\nF\nG"},
+					}},
+				}},
+			}}, `{text y:0 h:40 "A"}|{text y:0 h:80 "B\nC"}|{text y:0 h:40 "D"}|` +
+			`{text y:0 h:80 "E\nF"}{text x:230 y:0 h:40 "G"}`},
+		{"footers", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "footer", Box: Box{Dim: Dim{H: 20}}, Flow: Flow{Pages: "odd"}, List: []*Node{
+				{Kind: "text", Data: "odd µ{page}"},
+			}},
+			{Kind: "footer", Box: Box{Dim: Dim{H: 20}}, Flow: Flow{Pages: "even", Skip: []int{2}}, List: []*Node{
+				{Kind: "text", Data: "even µ{page}"},
+			}},
+			{Kind: "footer", Box: Box{Dim: Dim{H: 60}}, Flow: Flow{Pages: "last"}, List: []*Node{
+				{Kind: "text", Data: "last µ{page}"},
+			}},
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "A\nB\nC\nD\nE\nF"},
+			}},
+		}}, `{text y:80 h:40 "odd 1"}{text y:0 h:80 "A\nB"}|{text y:0 h:80 "C\nD"}|` +
+			`{text y:80 h:40 "odd 3"}{text y:0 h:40 "E"}|{text y:40 h:40 "last 4"}{text y:0 h:40 "F"}`},
+		{"footer blocks", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "footer", Box: Box{Dim: Dim{H: 20}}, List: []*Node{
+				{Kind: "text", Data: "µ{page}"},
+			}},
+			{Kind: "footer", Box: Box{Dim: Dim{H: 60}}, Flow: Flow{Pages: "last"}, List: []*Node{
+				{Kind: "text", Data: "last µ{page}"},
+			}},
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "A"},
+				{Kind: "text", Data: "B"},
+			}},
+		}}, `{text y:80 h:40 "1"}{text y:0 h:40 "A"}|{text y:40 h:40 "last 2"}{text y:0 h:40 "B"}`},
+		{"footnotes", &Node{Kind: "page", Box: Box{Dim: Dim{400, 200}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "A^[Note a]\nB"},
+				{Kind: "markup", Data: "C D^[Note d]"},
+			}},
+		}}, `{text y:0 h:40 "A[1]"}{text y:40 h:40 "B"}{line y:148 h:0}{text y:160 h:40 "[1] Note a"}|` +
+			`{text y:0 h:40 "C"}{text x:32 y:0 h:40 "D[2]"}{line y:148 h:0}{text y:160 h:40 "[2] Note d"}`},
+		{"column footnotes", &Node{Kind: "page", Box: Box{Dim: Dim{420, 200}},
+			Flow: Flow{Columns: 2, Gutter: 20}, List: []*Node{
+				{Kind: "vbox", List: []*Node{
+					{Kind: "text", Data: "A\nB\nC\nD\nE^[Note e]"},
+				}},
+			}}, `{text y:0 h:40 "A"}{text y:40 h:40 "B"}{text y:80 h:40 "C"}{text y:120 h:40 "D"}` +
+			`{text x:220 y:0 h:40 "E[1]"}{line x:220 y:148 h:0}{text x:220 y:160 h:40 "[1] Note e"}`},
+		{"column long note", &Node{Kind: "page", Box: Box{Dim: Dim{420, 400}},
+			Flow: Flow{Columns: 2, Gutter: 20}, List: []*Node{
+				{Kind: "vbox", List: []*Node{
+					{Kind: "markup", Data: "A^[one two three four five six seven]"},
+				}},
+			}}, `{text y:0 h:40 "A[1]"}{line y:268 h:0}` +
+			`{text y:280 h:120 "[1] one two\nthree four\nfive six seven"}`},
+		{"toc", &Node{Kind: "page", Box: Box{Dim: Dim{400, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "toc"},
+				{Kind: "text", Data: "One", Flow: Flow{Level: 1, BreakBefore: true}},
+				{Kind: "markup", Data: "*Two*", Flow: Flow{Level: 2}},
+			}},
+		}}, `{text y:0 h:40 "One"}{text x:68.5 y:0 h:40 "..........................."}{text x:381 y:0 h:40 "2"}` +
+			`{text x:40 y:40 h:40 "Two"}{text x:108.5 y:40 h:40 "......................."}{text x:381 y:40 h:40 "2"}|` +
+			`{text y:0 h:40 "One"}{bookmark y:0 h:0 "One"}{text y:40 h:40 "Two"}{bookmark y:40 h:0 "Two"}`},
+		{"running", &Node{Kind: "page", Box: Box{Dim: Dim{800, 140}}, List: []*Node{
+			{Kind: "header", Box: Box{Dim: Dim{H: 40}}, List: []*Node{
+				{Kind: "text", Data: "µ{first:aisle}-µ{last:aisle}"},
+			}},
+			{Kind: "cover", Box: Box{Dim: Dim{H: 40}}, List: []*Node{
+				{Kind: "text", Data: "µ{title} µ{first:aisle}-µ{last:aisle}"},
+			}},
+			{Kind: "vbox", List: []*Node{
+				{Kind: "text", Data: "Title", Flow: Flow{Level: 1}},
+				{Kind: "table", Table: Table{Cols: []Dot{0}}, List: []*Node{
+					{Kind: "text", Data: "A1", Flow: Flow{Mark: "aisle"}},
+					{Kind: "text", Data: "A2", Flow: Flow{Mark: "aisle"}},
+					{Kind: "text", Data: "A3", Flow: Flow{Mark: "aisle"}},
+				}},
+			}},
+		}}, `{text y:0 h:40 "Title A1-A1"}{text y:40 h:40 "Title"}{bookmark y:40 h:0 "Title"}{text y:80 h:40 "A1"}|` +
+			`{text y:0 h:40 "A2-A3"}{text y:40 h:40 "A2"}{text y:80 h:40 "A3"}`},
+		{"block markup", &Node{Kind: "page", Box: Box{Dim: Dim{400, 160}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "A\nB\n---\n# Head\nC", Markup: Markup{Block: true, Para: 10,
+					Heads: []*Font{{Line: 60}}}},
+			}},
+		}}, `{text y:0 h:40 "A"}{text x:31 y:0 h:40 "B"}{line y:70 h:0}|` +
+			`{text y:0 h:60 "Head"}{bookmark y:0 h:0 "Head"}{text y:70 h:40 "C"}`},
+		{"link text", &Node{Kind: "page", Box: Box{Dim: Dim{400, 400}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "[a](u) [b](v)", Markup: Markup{Links: "text"}},
+				{Kind: "markup", Data: "[a](u) [b](u)", Markup: Markup{Links: "qrcode"}},
+			}},
+		}}, `{text y:0 h:40 "a" ->u}{text x:27 y:0 h:40 "(u)"}{text x:76 y:0 h:40 "b" ->v}{text x:103 y:0 h:40 "(v)"}` +
+			`{text y:40 h:40 "a" ->u}{text x:27 y:40 h:40 "b" ->u}{qrcode y:100 h:118.41666666666667 "u"}`},
+		{"attributes", &Node{Kind: "page", Box: Box{Dim: Dim{400, 400}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "{size=24}12{size=10},99 € {color=red}x\nnext"},
+			}},
+		}}, `{text y:0 h:81 "12"}{text x:75 y:41 h:33 ",99"}{text x:123 y:35 h:40 "€"}{text x:150 y:35 h:40 "x"}` +
+			`{text y:81 h:40 "next"}`},
+		{"images", &Node{Kind: "page", Box: Box{Dim: Dim{300, 400}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "flour ![gluten](gluten), [egg ![](icon)](u) milk"},
+			}},
+		}}, `{text y:0 h:40 "flour"}{image x:74 y:0 h:40 "gluten"}{text x:154 y:0 h:40 ","}{text x:173 y:0 h:40 "egg" ->u}` +
+			`{image y:40 h:40 "icon" ->u}{text x:88 y:40 h:40 "milk"}`},
+		{"image file names", &Node{Kind: "page", Box: Box{Dim: Dim{300, 400}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "![allergen](gluten.png) ![](icon.png)"},
+			}},
+		}}, `{image y:0 h:40 "gluten.png"}{image x:88 y:0 h:40 "icon.png"}`},
+		{"image valign", &Node{Kind: "page", Box: Box{Dim: Dim{400, 400}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "{size=24}X {valign=top}![](icon) {valign=bottom}![](icon) " +
+					"{valign=base}![](icon) ![](icon)"},
+			}},
+		}}, `{text y:0 h:81 "X"}{image x:53 y:0 h:40 "icon"}{image x:141 y:41 h:40 "icon"}{image x:229 y:30 h:40 "icon"}` +
+			`{image x:317 y:35 h:40 "icon"}`},
+		{"block spacing", &Node{Kind: "page", Box: Box{Dim: Dim{400, 400}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "one\n\n## Head\n\ntwo three\n\n- four", Font: &Font{Line: 1},
+					Markup: Markup{Block: true, Before: 4, After: 6, HeadBefore: 20, HeadAfter: 2,
+						Indent: 16}},
+			}},
+		}}, `{text x:16 y:0 h:33 "one"}{text y:59 h:40 "Head"}{bookmark y:59 h:0 "Head"}` +
+			`{text x:16 y:105 h:33 "two"}{text x:76 y:105 h:33 "three"}{text y:148 h:33 "•"}{text x:33 y:148 h:33 "four"}`},
+		{"indent too wide", &Node{Kind: "page", Box: Box{Dim: Dim{100, 400}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "abcde fg", Markup: Markup{Indent: 40}},
+			}},
+		}}, `{text y:0 h:40 "abcde"}{text y:40 h:40 "fg"}`},
+		{"block spacing break", &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "one\n\ntwo", Markup: Markup{Block: true, Before: 20, After: 20}},
+			}},
+		}}, `{text y:0 h:40 "one"}|{text y:0 h:40 "two"}`},
+		{"mixed line break", &Node{Kind: "page", Box: Box{Dim: Dim{400, 115}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "a\n{size=6}b {size=24}B"},
+			}},
+		}}, `{text y:0 h:40 "a"}|{text y:53 h:20 "b"}{text x:17 y:0 h:81 "B"}`},
+		{"block list", &Node{Kind: "page", Box: Box{Dim: Dim{140, 400}}, List: []*Node{
+			{Kind: "vbox", List: []*Node{
+				{Kind: "markup", Data: "- one two\n  1. a\n- b", Markup: Markup{Block: true}},
+			}},
+		}}, `{text y:0 h:40 "•"}{text x:40 y:0 h:40 "one"}{text x:40 y:40 h:40 "two"}` +
+			`{text x:43 y:80 h:40 "1."}{text x:80 y:80 h:40 "a"}{text y:120 h:40 "•"}{text x:40 y:120 h:40 "b"}`},
+	}
+	for _, test := range tests {
+		lay := &Layouter{man, 'i', FakeBoldStyler}
+		doc, err := lay.LayoutAndPage(test.node)
+		if err != nil {
+			t.Errorf("%s layout error: %v", test.name, err)
+			continue
+		}
+		if got := drawString(doc.Draw()); got != test.want {
+			t.Errorf("%s\nwant: %s\n got: %s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestPageNodes(t *testing.T) {
+	man := font.NewManager(72, 2, 4).RegisterTTF("", "testdata/font/Go-Regular.ttf")
+	if err := man.Err(); err != nil {
+		t.Fatalf("register font error: %v", err)
+	}
+	a := &Node{Kind: "text", Data: "A"}
+	b := &Node{Kind: "text", Data: "B\nC"}
+	box := &Node{Kind: "vbox", List: []*Node{a, b}}
+	n := &Node{Kind: "page", Box: Box{Dim: Dim{200, 100}}, List: []*Node{box}}
+	lay := &Layouter{man, 'i', FakeBoldStyler}
+	doc, err := lay.LayoutAndPage(n)
+	if err != nil {
+		t.Fatalf("layout error: %v", err)
+	}
+	if len(doc.Pages) != 2 {
+		t.Fatalf("want 2 pages got %d", len(doc.Pages))
+	}
+	want := [][]*Node{{a, b, box}, {b, box}}
+	for i, pg := range doc.Pages {
+		if pg.Index != i || pg.W != 200 || pg.H != 100 {
+			t.Errorf("page %d got index %d dim %v", i, pg.Index, pg.Dim)
+		}
+		if len(pg.Nodes) != len(want[i]) {
+			t.Errorf("page %d want %d nodes got %d", i, len(want[i]), len(pg.Nodes))
+			continue
+		}
+		for j, e := range want[i] {
+			if pg.Nodes[j] != e {
+				t.Errorf("page %d node %d want %s got %s", i, j, e.Data, pg.Nodes[j].Data)
+			}
+		}
+	}
+}
+
+func TestPageDims(t *testing.T) {
+	man := font.NewManager(72, 2, 4).RegisterTTF("", "testdata/font/Go-Regular.ttf")
+	if err := man.Err(); err != nil {
+		t.Fatalf("register font error: %v", err)
+	}
+	land := &Node{Kind: "section", Flow: Flow{Land: true}, List: []*Node{
+		{Kind: "text", Data: "Wide"},
+	}}
+	cols := &Node{Kind: "section", Flow: Flow{Columns: 3, Gutter: 10}, List: []*Node{
+		{Kind: "text", Data: "Narrow"},
+	}}
+	a := &Node{Kind: "text", Data: "A"}
+	n := &Node{Kind: "page", Box: Box{Dim: Dim{100, 200}}, Flow: Flow{Columns: 2, Gutter: 20}, List: []*Node{
+		{Kind: "vbox", List: []*Node{
+			a,
+			land,
+			cols,
+			{Kind: "text", Data: "B"},
+		}},
+	}}
+	lay := &Layouter{man, 'i', FakeBoldStyler}
+	doc, err := lay.LayoutAndPage(n)
+	if err != nil {
+		t.Fatalf("layout error: %v", err)
+	}
+	if a.Calc.W != 40 {
+		t.Errorf("want column width 40 got %v", a.Calc.W)
+	}
+	if land.Calc.W != 90 {
+		t.Errorf("want section width 90 got %v", land.Calc.W)
+	}
+	if cols.Calc.W != 26 {
+		t.Errorf("want section width 26 got %v", cols.Calc.W)
+	}
+	want := []Dim{{100, 200}, {200, 100}, {100, 200}, {100, 200}}
+	if len(doc.Pages) != len(want) {
+		t.Fatalf("want %d pages got %d: %s", len(want), len(doc.Pages), drawString(doc.Draw()))
+	}
+	for i, pg := range doc.Pages {
+		if pg.Dim != want[i] {
+			t.Errorf("page %d want dim %v got %v", i, want[i], pg.Dim)
+		}
+	}
+}
+
+func TestParseNum(t *testing.T) {
+	tests := []struct {
+		raw   string
+		v     float64
+		prec  int
+		comma bool
+		ok    bool
+	}{
+		{"1,234.50", 1234.5, 2, false, true},
+		{"1.234,50", 1234.5, 2, true, true},
+		{"12,50 €", 12.5, 2, true, true},
+		{"EUR -3", -3, 0, false, true},
+		{"$7.5", 7.5, 1, false, true},
+		{"2 x 3", 0, 0, false, false},
+		{"Art. 4711, 12,50", 0, 0, false, false},
+		{"12kg", 12, 0, false, true},
+		{"4a7", 0, 0, false, false},
+		{"none", 0, 0, false, false},
+	}
+	for _, test := range tests {
+		v, prec, comma, ok := parseNum(test.raw)
+		if v != test.v || prec != test.prec || comma != test.comma || ok != test.ok {
+			t.Errorf("parse %q want %g %d %v %v got %g %d %v %v", test.raw,
+				test.v, test.prec, test.comma, test.ok, v, prec, comma, ok)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"xelf.org/layla"
 	"xelf.org/layla/bcode"
 	"xelf.org/layla/font"
+	"xelf.org/layla/mark"
 )
 
 type Doc = gofpdf.Fpdf
@@ -64,22 +65,48 @@ func (r Renderer) RenderTo(d *Doc, n *layla.Node) (*Doc, error) {
 }
 
 func (r Renderer) RenderSubjTo(d *Doc, n *layla.Node, subj string) (*Doc, error) {
-	d.AddPage()
-	if subj != "" {
-		subj, err := enc(subj)
-		if err == nil {
-			d.Bookmark(subj, 0, 0)
-		}
-	}
-	draw, err := layla.LayoutAndPage(r.Manager, n)
+	doc, err := layla.LayoutAndPage(r.Manager, n)
 	if err != nil {
 		return nil, err
 	}
-	r.addFonts(d, draw)
-	for _, dn := range draw {
-		err = r.renderNode(d, dn)
-		if err != nil {
-			return nil, err
+	r.addFonts(d, doc.Draw())
+	// prev is the last bookmark level, bookmarks must not nest deeper than one below it
+	prev := -1
+	for i, pg := range doc.Pages {
+		if pg.Dim != n.Dim {
+			// pages of sections with another size or orientation
+			d.AddPageFormat("P", gofpdf.SizeType{Wd: float64(pg.W / 8), Ht: float64(pg.H / 8)})
+		} else {
+			d.AddPage()
+		}
+		if i == 0 && subj != "" {
+			if subj, err := enc(subj); err == nil {
+				d.Bookmark(subj, 0, 0)
+				prev = 0
+			}
+		}
+		for _, dn := range pg.Draw {
+			if dn.Kind == "bookmark" {
+				// headings are nested below the subject bookmark
+				level := dn.Level - 1
+				if subj != "" {
+					level++
+				}
+				if level > prev+1 {
+					level = prev + 1
+				} else if level < 0 {
+					level = 0
+				}
+				prev = level
+				if title, err := enc(dn.Data); err == nil {
+					d.Bookmark(title, level, float64(dn.Y/8))
+				}
+				continue
+			}
+			err = r.renderNode(d, dn)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 	return d, d.Error()
@@ -91,10 +118,11 @@ func (r Renderer) addFonts(d *Doc, ns []*layla.Node) error {
 		if n.Font == nil {
 			continue
 		}
-		if fs[n.Font.Name] {
+		name := n.Font.FaceName()
+		if fs[name] {
 			continue
 		}
-		path, err := r.Path(n.Font.Name)
+		path, err := r.Path(name)
 		if err != nil {
 			return err
 		}
@@ -102,13 +130,13 @@ func (r Renderer) addFonts(d *Doc, ns []*layla.Node) error {
 		d.SetFontLocation(dir)
 		ext := filepath.Ext(fname)
 		descf := fmt.Sprintf("%s.json", fname[:len(fname)-len(ext)])
-		d.AddFont(n.Font.Name, "", descf)
-		fs[n.Font.Name] = true
+		d.AddFont(name, "", descf)
+		fs[name] = true
 	}
 	return nil
 }
 
-func setupBorder(d *Doc, bwd font.Dot, c *layla.Color) float64 {
+func setupBorder(d *Doc, bwd font.Dot, br layla.Border, c *layla.Color) float64 {
 	bw := float64(bwd / 8)
 	d.SetLineWidth(bw)
 	if c == nil {
@@ -116,6 +144,11 @@ func setupBorder(d *Doc, bwd font.Dot, c *layla.Color) float64 {
 	} else {
 		d.SetDrawColor(c.R, c.G, c.B)
 	}
+	if dash, space := br.Pattern(bwd); dash > 0 {
+		d.SetDashPattern([]float64{float64(dash / 8), float64(space / 8)}, 0)
+	} else {
+		d.SetDashPattern(nil, 0)
+	}
 	return bw
 }
 func drawBorder(d *Doc, b layla.Box, br layla.Border, c *layla.Color) {
@@ -125,50 +158,82 @@ func drawBorder(d *Doc, b layla.Box, br layla.Border, c *layla.Color) {
 	x1, y1 := float64(b.X/8), float64(b.Y/8)
 	x2, y2 := float64((b.X+b.W)/8), float64((b.Y+b.H)/8)
 	if br.L > 0 {
-		setupBorder(d, br.L, c)
+		setupBorder(d, br.L, br, c)
 		d.Line(x1, y1, x1, y2)
 	}
 	if br.T > 0 {
-		setupBorder(d, br.T, c)
+		setupBorder(d, br.T, br, c)
 		d.Line(x1, y1, x2, y1)
 	}
 	if br.R > 0 {
-		setupBorder(d, br.R, c)
+		setupBorder(d, br.R, br, c)
 		d.Line(x2, y1, x2, y2)
 	}
 	if br.B > 0 {
-		setupBorder(d, br.B, c)
+		setupBorder(d, br.B, br, c)
 		d.Line(x1, y2, x2, y2)
 	}
 }
 
+func setupFill(d *Doc, c *layla.Color) string {
+	if c == nil {
+		return "D"
+	}
+	d.SetFillColor(c.R, c.G, c.B)
+	return "FD"
+}
+func drawFill(d *Doc, b layla.Box, c *layla.Color) {
+	if c == nil {
+		return
+	}
+	d.SetFillColor(c.R, c.G, c.B)
+	d.Rect(float64(b.X/8), float64(b.Y/8), float64(b.W/8), float64(b.H/8), "F")
+}
+
 func (r Renderer) renderNode(d *Doc, n *layla.Node) error {
 	switch n.Kind {
 	case "ellipse":
 		b := n.Border.Default(1.6)
-		d.SetLineWidth(float64(b.W / 8))
+		setupBorder(d, b.W, b, n.Stroke)
 		rx, ry := n.W/16, n.H/16
-		d.Ellipse(float64(n.X/8+rx), float64(n.Y/8+ry), float64(rx), float64(ry), 0, "D")
+		d.Ellipse(float64(n.X/8+rx), float64(n.Y/8+ry), float64(rx), float64(ry), 0,
+			setupFill(d, n.Fill))
 	case "line":
 		b := n.Border.Default(1.6)
-		d.SetDrawColor(0, 0, 0)
-		d.SetLineWidth(float64(b.W / 8))
+		setupBorder(d, b.W, b, n.Stroke)
 		x, y := float64(n.X/8), float64(n.Y/8)
 		d.Line(x, y, x+float64(n.W/8), y+float64(n.H/8))
 	case "rect":
 		b := n.Border.Default(1.6)
-		drawBorder(d, n.Box, b, nil)
+		drawFill(d, n.Box, n.Fill)
+		drawBorder(d, n.Box, b, n.Stroke)
+	case "box":
+		drawFill(d, n.Box, n.Fill)
+		drawBorder(d, n.Box, n.Border.Default(0), n.Stroke)
 	case "text":
 		br := n.Border.Default(0)
-		drawBorder(d, n.Box, br, nil)
+		drawFill(d, n.Box, n.Fill)
+		drawBorder(d, n.Box, br, n.Stroke)
+		if c := n.Color; c != nil {
+			d.SetTextColor(c.R, c.G, c.B)
+		} else {
+			d.SetTextColor(0, 0, 0)
+		}
 
-		y, fsize := n.Y, n.Font.Size
+		y, fsize := n.Y+n.Font.Shift(), n.Font.Size
 		if r.Compat { // tspl render compatibility mode
 			// for some reason these parameters fit tspl label printer text rendering
 			y -= font.Dot(fsize * .75)
 			fsize *= .96
 		}
-		d.SetFont(n.Font.Name, "", fsize)
+		var style string
+		if n.Font.Style&mark.Under != 0 {
+			style += "U"
+		}
+		if n.Font.Style&mark.Strike != 0 {
+			style += "S"
+		}
+		d.SetFont(n.Font.FaceName(), style, fsize)
 		b := n.Pad.Inset(n.Box)
 		res, err := enc(n.Data)
 		if err != nil {
@@ -191,6 +256,16 @@ func (r Renderer) renderNode(d *Doc, n *layla.Node) error {
 		}
 		d.SetXY(float64(x/8), float64(y/8))
 		d.MultiCell(float64(w/8), float64(n.Font.Line/8), res, "", align, false)
+		if n.Link != "" {
+			d.LinkString(float64(b.X/8), float64(b.Y/8), float64(b.W/8), float64(b.H/8), n.Link)
+		}
+	case "image":
+		ic, ok := r.Icon(n.Data)
+		if !ok {
+			return fmt.Errorf("unknown image %q", n.Data)
+		}
+		d.ImageOptions(ic.Path, float64(n.X/8), float64(n.Y/8), float64(n.W/8), float64(n.H/8),
+			false, gofpdf.ImageOptions{}, 0, n.Link)
 	case "barcode", "qrcode":
 		coder := r.Barcoder
 		if coder == nil {
@@ -210,8 +285,6 @@ func (r Renderer) renderNode(d *Doc, n *layla.Node) error {
 		d.RegisterImageOptionsReader(name, iopt, &b)
 		d.ImageOptions(name, float64(n.X/8), float64(n.Y/8), float64(n.W/8), float64(n.H/8),
 			false, iopt, 0, "")
-	case "page":
-		d.AddPage()
 	default:
 		return fmt.Errorf("unexpected node kind %q", n.Kind)
 	}
@@ -37,6 +37,7 @@ var testFiles = []string{
 	"pages",
 	"label1",
 	"label2",
+	"colors",
 }
 
 func TestHtml(t *testing.T) {
@@ -2,42 +2,88 @@ package layla
 
 import (
 	"bytes"
+	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/boombuler/barcode/qr"
 	"xelf.org/layla/font"
 	"xelf.org/layla/mark"
 	"xelf.org/xelf/cor"
 )
 
 func (l *Layouter) lineLayout(n *Node, stack []*Node) (err error) {
-	markup := n.Kind == "markup"
-	var els []mark.El
-	if markup {
-		els, err = mark.Inline(n.Data)
-		if err != nil {
-			return err
-		}
-	} else {
-		els = []mark.El{{Cont: n.Data}}
+	if n.Kind == "markup" && n.Block {
+		return l.blockLayout(n, stack)
 	}
+	data, notes := splitNotes(n.Data)
 	stack = append(stack, n)
 	of := getFont(stack)
+	n.Font = of
 	b := n.Pad.Inset(n.Calc)
+	fns, err := l.noteLayout(notes, b, stack)
+	if err != nil {
+		return err
+	}
+	if n.Kind == "markup" {
+		els, err := mark.Inline(data)
+		if err != nil {
+			return err
+		}
+		_, err = l.markLayout(n, els, fns)
+		return err
+	}
 	lh, err := l.lineHeight(of)
 	if err != nil {
 		return err
 	}
 	s := &splitter{Layouter: l, Font: *of, Max: b.W}
-	res, err := s.lines(els)
+	res, err := s.lines([]mark.El{{Cont: data}})
 	if err != nil {
 		return err
 	}
-	if markup {
-		n.List = make([]*Node, 0, len(res))
+	if len(fns) > 0 {
+		n.List = fns
 	}
 	var buf bytes.Buffer
 	var y, mw Dot
 	for li, line := range res {
+		if li > 0 {
+			buf.WriteByte('\n')
+		}
+		for _, sp := range line.Spans {
+			buf.WriteString(sp.Text)
+		}
+		if line.W > mw {
+			mw = line.W
+		}
+		y += lh
+	}
+	n.Data = buf.String()
+	fitLines(n, b, mw, y)
+	return nil
+}
+
+// markLayout sets the list of markup node n to word nodes for the inline elements els and
+// assigns the footnotes fns to the words with their markers. It returns the unused footnotes.
+func (l *Layouter) markLayout(n *Node, els []mark.El, fns []*Node) ([]*Node, error) {
+	of := n.Font
+	lh, err := l.lineHeight(of)
+	if err != nil {
+		return nil, err
+	}
+	b := n.Pad.Inset(n.Calc)
+	if n.Links == "text" {
+		els = linkText(els)
+	}
+	s := &splitter{Layouter: l, Font: *of, Max: b.W, Indent: n.Indent}
+	res, err := s.lines(els)
+	if err != nil {
+		return nil, err
+	}
+	n.List = make([]*Node, 0, len(res))
+	var y, mw Dot
+	for _, line := range res {
 		bx := b.X
 		switch n.Align {
 		case 2: // center
@@ -45,43 +91,342 @@ func (l *Layouter) lineLayout(n *Node, stack []*Node) (err error) {
 		case 3: // right
 			bx += (b.W - line.W).Floor()
 		}
-		if !markup && li > 0 {
-			buf.WriteByte('\n')
+		// spans are aligned at the lowest baseline and the line is as high as the tallest span
+		var base, h Dot
+		for _, sp := range line.Spans {
+			if sp.Base > base {
+				base = sp.Base
+			}
+		}
+		for _, sp := range line.Spans {
+			if sh := base - sp.Base + sp.H; sh > h {
+				h = sh
+			}
+		}
+		if h <= 0 {
+			h = lh
 		}
 		var x Dot
 		for _, sp := range line.Spans {
-			w := sp.W
-			if !markup {
-				buf.WriteString(sp.Text)
+			if sp.Tag&mark.Image != 0 {
+				iy := base - sp.Base
+				switch sp.VAlign {
+				case "top":
+					iy = 0
+				case "middle":
+					iy = ((h - sp.H) / 2).Floor()
+				case "bottom":
+					iy = h - sp.H
+				}
+				n.List = append(n.List, &Node{
+					Kind: "image",
+					Data: sp.Text,
+					Calc: Box{
+						Pos: Pos{X: bx + x, Y: b.Y + y + iy},
+						Dim: Dim{W: sp.W, H: sp.H},
+					},
+					Link: sp.Link,
+				})
 			} else if sp.Text != " " {
 				of := of
+				if sp.Font != nil {
+					of = sp.Font
+				}
 				if sp.Tag != 0 {
-					ofv := *of
+					ofv := scriptFont(*of, sp.Tag)
 					ofv.Style = sp.Tag
+					f, err := l.Styler(l.Manager, ofv, sp.Tag)
+					if err != nil {
+						return nil, err
+					}
+					if f.Name != "" {
+						// the family face is drawn with only fake bold left to renderers
+						ofv.Face = f.Name
+						if f.Add == 0 {
+							ofv.Style &^= mark.Bold
+						}
+					}
 					of = &ofv
 				}
-				n.List = append(n.List, &Node{
+				color := n.Color
+				if sp.Color != nil {
+					color = sp.Color
+				}
+				c := &Node{
 					Kind: "text",
 					Data: sp.Text,
 					Calc: Box{
-						Pos: Pos{X: bx + x, Y: b.Y + y},
-						Dim: Dim{W: w, H: lh},
+						Pos: Pos{X: bx + x, Y: b.Y + y + base - sp.Base},
+						Dim: Dim{W: sp.W, H: sp.H},
 					},
-					Font: of,
-				})
+					Font:  of,
+					Color: color,
+					Link:  sp.Link,
+				}
+				// footnotes are kept with the word node of their marker
+				if nc := strings.Count(sp.Text, noteMark); nc > 0 && len(fns) >= nc {
+					c.List, fns = fns[:nc], fns[nc:]
+				}
+				n.List = append(n.List, c)
 			}
-			if x+w > mw {
-				mw = x + w
+			x += sp.W
+		}
+		if x > mw {
+			mw = x
+		}
+		y += h
+	}
+	if n.Links == "qrcode" {
+		if y, err = l.linkCodes(n, els, b, y, lh); err != nil {
+			return nil, err
+		}
+	}
+	fitLines(n, b, mw, y)
+	return fns, nil
+}
+
+// linkText returns els with the target of each link appended as text.
+func linkText(els []mark.El) []mark.El {
+	res := make([]mark.El, 0, len(els))
+	for _, el := range els {
+		res = append(res, el)
+		if el.Tag&mark.Link != 0 {
+			res = append(res, mark.El{Tag: el.Tag &^ mark.Link, Cont: " (" + el.Cont + ")"})
+		}
+	}
+	return res
+}
+
+// linkCodes appends qrcode nodes for the link targets in els to markup node n below the text
+// at offset y in box b and returns the offset below the codes. Codes are at most three lines
+// high and use a whole number of printer dots per module, so the printed code fits its box.
+func (l *Layouter) linkCodes(n *Node, els []mark.El, b Box, y, lh Dot) (Dot, error) {
+	// pd is the size of one printer dot
+	pd := Dot(1)
+	if dpi := l.DPI(); dpi < 200 || dpi > 203 {
+		pd = Dot(203) / Dot(dpi)
+	}
+	var x, rh Dot
+	seen := make(map[string]bool)
+	for _, el := range els {
+		if el.Tag&mark.Link == 0 || seen[el.Cont] {
+			continue
+		}
+		seen[el.Cont] = true
+		code, err := qr.Encode(el.Cont, qr.M, qr.Auto)
+		if err != nil {
+			return y, fmt.Errorf("link qrcode %q: %v", el.Cont, err)
+		}
+		mods := Dot(code.Bounds().Dx())
+		cell := (3 * lh / pd / mods).Floor()
+		if cell < 1 {
+			cell = 1
+		}
+		wide := cell * pd
+		q := wide * mods
+		if x > 0 && x+q > b.W {
+			x, y, rh = 0, y+rh+lh/2, 0
+		}
+		if x == 0 {
+			y += lh / 2
+		}
+		n.List = append(n.List, &Node{Kind: "qrcode", Data: el.Cont,
+			Code: &Code{Name: "m", Wide: wide},
+			Calc: Box{Pos: Pos{X: b.X + x, Y: b.Y + y}, Dim: Dim{W: q, H: q}}})
+		if q > rh {
+			rh = q
+		}
+		x += q + lh/2
+	}
+	return y + rh, nil
+}
+
+// blockLayout sets the list of block markup node n to markup nodes for each paragraph and
+// heading and line nodes for rulers. Headings are kept with the next block and have an
+// outline level.
+func (l *Layouter) blockLayout(n *Node, stack []*Node) error {
+	data, notes := splitNotes(n.Data)
+	els, err := mark.Parse(data)
+	if err != nil {
+		return err
+	}
+	stack = append(stack, n)
+	of := getFont(stack)
+	n.Font = of
+	b := n.Pad.Inset(n.Calc)
+	fns, err := l.noteLayout(notes, b, stack)
+	if err != nil {
+		return err
+	}
+	lh, err := l.lineHeight(of)
+	if err != nil {
+		return err
+	}
+	n.List = make([]*Node, 0, len(els))
+	y := b.Y
+	var after Dot
+	for i, el := range els {
+		before, next := blockSpace(n, el)
+		if i > 0 {
+			y += n.Para + after + before
+		}
+		after = next
+		a := Box{Pos: Pos{X: b.X, Y: y}, Dim: Dim{W: b.W}}
+		switch el.Tag {
+		case mark.Ruler:
+			a.Y += lh / 2
+			n.List = append(n.List, &Node{Kind: "line", Border: Border{W: 2}, Stroke: n.Stroke, Calc: a})
+			y += lh
+			continue
+		case mark.List:
+			if y, fns, err = l.listLayout(n, el, a, fns); err != nil {
+				return err
 			}
-			x += w
+			continue
 		}
-		y += lh
+		c := &Node{Kind: "markup", Font: of, Color: n.Color, Calc: a}
+		c.Align, c.Links = n.Align, n.Links
+		c.Orphans, c.Widows = n.Orphans, n.Widows
+		if el.Tag == mark.Para {
+			c.Indent = n.Indent
+		}
+		if lvl := headLevel(el.Tag); lvl > 0 {
+			c.Font = headFont(n, of, lvl)
+			c.Data, c.Level, c.KeepNext = el.Cont, lvl, true
+			if el.Els, err = mark.Inline(el.Cont); err != nil {
+				return err
+			}
+			if c.Font.Style&mark.Bold != 0 {
+				for i := range el.Els {
+					el.Els[i].Tag |= mark.Bold
+				}
+			}
+		}
+		if fns, err = l.markLayout(c, el.Els, fns); err != nil {
+			return err
+		}
+		n.List = append(n.List, c)
+		y += c.Calc.H
+	}
+	fitLines(n, b, b.W, y-b.Y)
+	return nil
+}
+
+// blockSpace returns the space before and after block el of block markup node n.
+func blockSpace(n *Node, el mark.El) (before, after Dot) {
+	switch {
+	case el.Tag&mark.Header != 0:
+		return n.HeadBefore, n.HeadAfter
+	case el.Tag&(mark.Para|mark.List) != 0:
+		return n.Before, n.After
+	}
+	return 0, 0
+}
+
+// listLayout appends markup nodes for the items of list el in box a to block markup node n and
+// returns the offset below the list and the unused footnotes. Item text is indented by the
+// widest marker, so that wrapped lines hang below the text. Bullets are drawn as •, numbers as
+// written and right aligned.
+func (l *Layouter) listLayout(n *Node, el mark.El, a Box, fns []*Node) (Dot, []*Node, error) {
+	of := n.Font
+	f, err := l.Styler(l.Manager, *of, mark.Text)
+	if err != nil {
+		return 0, nil, err
 	}
-	if !markup {
-		n.Data = buf.String()
+	s := &splitter{Layouter: l, Font: *of}
+	sdot := Dot(f.Rune(l.Spacer, -1)).Ceil()
+	marks := make([]string, len(el.Els))
+	hang := of.Line
+	for i, it := range el.Els {
+		marks[i] = "•"
+		if c := it.Cont[0]; c >= '0' && c <= '9' {
+			marks[i] = it.Cont
+		}
+		if w := s.spanW(f, marks[i]) + sdot; w > hang {
+			hang = w
+		}
 	}
-	b.H = y
-	b.W = mw
+	y := a.Y
+	for i, it := range el.Els {
+		var els, subs []mark.El
+		for _, e := range it.Els {
+			if e.Tag == mark.List {
+				subs = append(subs, e)
+			} else {
+				els = append(els, e)
+			}
+		}
+		c := &Node{Kind: "markup", Font: of, Color: n.Color,
+			Calc: Box{Pos: Pos{X: a.X + hang, Y: y}, Dim: Dim{W: a.W - hang}}}
+		c.Links = n.Links
+		c.Orphans, c.Widows = n.Orphans, n.Widows
+		if fns, err = l.markLayout(c, els, fns); err != nil {
+			return 0, nil, err
+		}
+		// the marker is the first word of the first line
+		mw := s.spanW(f, marks[i])
+		mx := a.X
+		if marks[i] != "•" {
+			mx += hang - sdot - mw
+		}
+		m := &Node{Kind: "text", Data: marks[i], Font: of, Color: n.Color,
+			Calc: Box{Pos: Pos{X: mx, Y: y}, Dim: Dim{W: mw, H: of.Line}}}
+		c.List = append([]*Node{m}, c.List...)
+		if c.Calc.H < of.Line {
+			c.Calc.H = of.Line
+		}
+		n.List = append(n.List, c)
+		y += c.Calc.H
+		for _, sub := range subs {
+			sa := Box{Pos: Pos{X: a.X + hang, Y: y}, Dim: Dim{W: a.W - hang}}
+			if y, fns, err = l.listLayout(n, sub, sa, fns); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	return y, fns, nil
+}
+
+// headScale holds the default font size factors of heading levels one to four.
+var headScale = []float64{2, 1.5, 1.25, 1}
+
+// headFont returns the font of heading level lvl in block markup node n with base font of.
+// Headings are bold unless the heading font has a normal weight.
+func headFont(n *Node, of *Font, lvl int) *Font {
+	f := *of
+	f.Size *= headScale[lvl-1]
+	f.Line = 0
+	if lvl <= len(n.Heads) && n.Heads[lvl-1] != nil {
+		h := n.Heads[lvl-1]
+		if h.Name != "" {
+			f.Name = h.Name
+		}
+		if h.Size > 0 {
+			f.Size = h.Size
+		}
+		f.Line = h.Line
+		if h.Weight == "normal" {
+			return &f
+		}
+	}
+	f.Style = mark.Bold
+	return &f
+}
+
+// headLevel returns the heading level of tag t or zero.
+func headLevel(t mark.Tag) int {
+	for i := 0; i < 4; i++ {
+		if t&(mark.Head1<<i) != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// fitLines sets the calculated size of node n for lines with width w and height h in box b.
+func fitLines(n *Node, b Box, w, h Dot) {
+	b.H = h
+	b.W = w
 	b = n.Pad.Outset(b)
 	n.Calc.H = clamp(n.Calc.H, b.H)
 	if n.W > 0 {
@@ -89,7 +434,77 @@ func (l *Layouter) lineLayout(n *Node, stack []*Node) (err error) {
 	} else {
 		n.Calc.W = clamp(n.Calc.W, b.W)
 	}
-	n.Font = of
+}
+
+// noteLayout returns the laid out footnote nodes for the note texts. The notes use the content
+// width of the page or column of the text node with box b.
+func (l *Layouter) noteLayout(notes []string, b Box, stack []*Node) ([]*Node, error) {
+	if len(notes) == 0 {
+		return nil, nil
+	}
+	a := Box{Pos: b.Pos, Dim: Dim{W: b.W}}
+	if w := columnWidth(stack); w > 0 {
+		a.W = w
+	}
+	res := make([]*Node, 0, len(notes))
+	for _, note := range notes {
+		fn := &Node{Kind: "footnote", Data: noteMark + " " + note}
+		if _, err := l.layout(fn, a, stack); err != nil {
+			return nil, err
+		}
+		res = append(res, fn)
+	}
+	return res, nil
+}
+
+// tocLayout sets the list of toc node n to text nodes for its outline entries. Each entry is
+// indented by its level and followed by dot leaders and the right aligned page number.
+func (l *Layouter) tocLayout(n *Node, stack []*Node) error {
+	stack = append(stack, n)
+	of := getFont(stack)
+	lh, err := l.lineHeight(of)
+	if err != nil {
+		return err
+	}
+	f, err := l.Styler(l.Manager, *of, mark.Text)
+	if err != nil {
+		return err
+	}
+	s := &splitter{Layouter: l, Font: *of}
+	dw := s.spanW(f, ".")
+	a := n.Pad.Inset(n.Calc)
+	n.List = make([]*Node, 0, len(n.Outline)*3)
+	y := a.Y
+	for _, e := range n.Outline {
+		var indent Dot
+		if e.Level > 1 {
+			indent = lh * Dot(e.Level-1)
+		}
+		num := strconv.Itoa(e.Page)
+		nw := s.spanW(f, num)
+		t := &Node{Kind: "text", Data: e.Title, Font: of}
+		tb := Box{Pos: Pos{X: a.X + indent, Y: y}, Dim: Dim{W: a.W - indent - nw - 2*dw}}
+		if tb.W <= 0 {
+			tb.W = a.W - indent
+		}
+		if _, err := l.layout(t, tb, stack); err != nil {
+			return err
+		}
+		// the leader and page number are placed on the last title line
+		last := t.Data[strings.LastIndexByte(t.Data, '\n')+1:]
+		lx := t.Calc.X + s.spanW(f, last) + dw/2
+		ly := t.Calc.Y + t.Calc.H - lh
+		n.List = append(n.List, t)
+		if c := int((a.X + a.W - nw - lx) / dw); c > 1 {
+			n.List = append(n.List, &Node{Kind: "text", Data: strings.Repeat(".", c-1), Font: of,
+				Calc: Box{Pos: Pos{X: lx, Y: ly}, Dim: Dim{W: dw * Dot(c-1), H: lh}}})
+		}
+		n.List = append(n.List, &Node{Kind: "text", Data: num, Font: of, NodeLayout: NodeLayout{Align: AlignRight},
+			Calc: Box{Pos: Pos{X: a.X + a.W - nw, Y: ly}, Dim: Dim{W: nw, H: lh}}})
+		y = t.Calc.Y + t.Calc.H
+	}
+	b := n.Pad.Outset(Box{Pos: a.Pos, Dim: Dim{W: a.W, H: y - a.Y}})
+	n.Calc.H = clamp(n.Calc.H, b.H)
 	return nil
 }
 
@@ -99,6 +514,7 @@ func (l *Layouter) lineHeight(f *Font) (lh Dot, _ error) {
 		return 0, err
 	}
 	f.Height = ff.Metrics().Height
+	f.Face = ff.Name
 
 	if f.Line <= 0 {
 		f.Line = 1.2
@@ -113,25 +529,199 @@ type splitter struct {
 	*Layouter
 	Font
 	Max Dot
+	// Indent is the first line indent.
+	Indent Dot
 }
 
 func (s *splitter) lines(els []mark.El) (res []line, err error) {
 	var cur line
 	res = make([]line, 0, len(els)/8)
-	for _, el := range els {
+	st := style{H: s.Font.Line}
+	if st.Base, err = s.baseline(s.Font); err != nil {
+		return nil, err
+	}
+	parts, err := s.parts(els, st, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.Indent > 0 && len(parts) > 0 {
+		// the indent is a space span that is not drawn
+		cur = line{Spans: []span{{" ", s.Indent, st}}, W: s.Indent}
+	}
+	for _, p := range parts {
+		if p.Tag&mark.Image != 0 {
+			if res, cur, err = s.image(p.style, p.Cont, res, cur); err != nil {
+				return res, err
+			}
+			continue
+		}
 		// select face
-		f, err := s.Styler(s.Manager, s.Font, el.Tag)
+		f, err := s.Styler(s.Manager, scriptFont(p.font(s.Font), p.Tag), p.Tag)
 		if err != nil {
 			return res, err
 		}
-		res, cur = s.spans(f, el.Tag, el.Cont, res, cur)
+		res, cur = s.spans(f, p.style, p.Cont, res, cur)
+	}
+	return s.flush(res, cur), nil
+}
+
+// flush appends line cur to res unless it is empty or only holds the first line indent. The
+// indent is dropped if the first word does not fit next to it.
+func (s *splitter) flush(res []line, cur line) []line {
+	if len(cur.Spans) == 0 || len(res) == 0 && s.Indent > 0 && len(cur.Spans) == 1 &&
+		cur.W == s.Indent {
+		return res
+	}
+	return append(res, cur)
+}
+
+// style holds the inline style of a span. The font and color are nil for the node defaults.
+// H is the line height and base the baseline offset in the line of the span font. VAlign is the
+// vertical alignment of images: top, middle or bottom of the line, base to sit on the baseline
+// or empty to be aligned like text.
+type style struct {
+	Tag    mark.Tag
+	Link   string
+	Font   *Font
+	Color  *Color
+	H      Dot
+	Base   Dot
+	VAlign string
+}
+
+func (st style) font(def Font) Font {
+	if st.Font != nil {
+		return *st.Font
 	}
-	if len(cur.Spans) > 0 {
-		res = append(res, cur)
+	return def
+}
+
+// part is text or an image source with its inline style.
+type part struct {
+	style
+	Cont string
+}
+
+// parts appends the text and image parts of els with the inline style st to res. Link texts and
+// attribute spans are flattened with the combined style.
+func (s *splitter) parts(els []mark.El, st style, res []part) (_ []part, err error) {
+	for _, el := range els {
+		pst := st
+		pst.Tag |= el.Tag &^ mark.Attr
+		switch {
+		case el.Tag&mark.Image != 0:
+			res = append(res, part{pst, el.Cont})
+		case el.Tag&mark.Attr != 0:
+			if pst, err = s.attrs(pst, el.Cont); err != nil {
+				return nil, err
+			}
+			res, err = s.parts(el.Els, pst, res)
+		case el.Tag&mark.Link != 0:
+			pst.Link = el.Cont
+			res, err = s.parts(el.Els, pst, res)
+		default:
+			res = append(res, part{pst, el.Cont})
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 	return res, nil
 }
 
+// attrs returns style st with the size, font, color and image valign attributes a applied.
+// Spans with another font or size use the default line height for that font.
+func (s *splitter) attrs(st style, a string) (style, error) {
+	f := st.font(s.Font)
+	for _, kv := range strings.Fields(a) {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return st, fmt.Errorf("invalid markup attribute %q", kv)
+		}
+		k, v := kv[:i], kv[i+1:]
+		switch k {
+		case "size":
+			size, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return st, fmt.Errorf("invalid markup size %q", v)
+			}
+			f.Size, f.Line = size, 0
+		case "font":
+			f.Name, f.Line = v, 0
+		case "color":
+			c, err := parseColor(v)
+			if err != nil {
+				return st, err
+			}
+			st.Color = c
+		case "valign":
+			switch v {
+			case "top", "middle", "bottom", "base":
+				st.VAlign = v
+			default:
+				return st, fmt.Errorf("invalid markup valign %q", v)
+			}
+		default:
+			return st, fmt.Errorf("unknown markup attribute %q", k)
+		}
+	}
+	if f.Line <= 0 {
+		lh, err := s.lineHeight(&f)
+		if err != nil {
+			return st, err
+		}
+		base, err := s.baseline(f)
+		if err != nil {
+			return st, err
+		}
+		st.Font, st.H, st.Base = &f, lh, base
+	}
+	return st, nil
+}
+
+// baseline returns the baseline offset of text with font f in a line of the font line height.
+func (l *Layouter) baseline(f Font) (Dot, error) {
+	ff, err := l.Styler(l.Manager, f, mark.Text)
+	if err != nil {
+		return 0, err
+	}
+	m := ff.Metrics()
+	return ((f.Line-l.PtToDot(m.Height))/2 + l.PtToDot(m.Ascent)).Floor(), nil
+}
+
+var colors = map[string]Color{
+	"black": {}, "white": {255, 255, 255}, "gray": {128, 128, 128},
+	"red": {255, 0, 0}, "green": {0, 128, 0}, "blue": {0, 0, 255},
+}
+
+// parseColor returns the color for a name or hex color like #ff0000.
+func parseColor(v string) (*Color, error) {
+	if c, ok := colors[v]; ok {
+		return &c, nil
+	}
+	if len(v) == 7 && v[0] == '#' {
+		if x, err := strconv.ParseUint(v[1:], 16, 32); err == nil {
+			return &Color{int(x >> 16), int(x >> 8 & 0xff), int(x & 0xff)}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid markup color %q", v)
+}
+
+// scriptScale is the font size factor for superscript and subscript text.
+const scriptScale = 0.6
+
+// scriptFont returns f with a reduced size for superscript and subscript tags.
+func scriptFont(f Font, t mark.Tag) Font {
+	if t&(mark.Sup|mark.Sub) != 0 {
+		if f.Size <= 0 {
+			// the truetype default size
+			f.Size = 12
+		}
+		f.Size *= scriptScale
+	}
+	return f
+}
+
 type line struct {
 	Spans []span
 	W     Dot
@@ -140,7 +730,27 @@ type line struct {
 type span struct {
 	Text string
 	W    Dot
-	Tag  mark.Tag
+	style
+}
+
+// image appends an unbreakable span for the icon src to cur and returns the lines. The image is
+// as high as a text line of the span font. Only icons registered with the manager can be used.
+func (s *splitter) image(st style, src string, res []line, cur line) ([]line, line, error) {
+	ic, ok := s.Icon(src)
+	if !ok {
+		return res, cur, fmt.Errorf("unknown markup icon %q", src)
+	}
+	if st.VAlign == "base" {
+		// the image bottom sits on the baseline
+		st.Base = st.H
+	}
+	w := (st.H * Dot(ic.W) / Dot(ic.H)).Ceil()
+	if cur.W+w > s.Max && len(cur.Spans) > 0 {
+		res, cur = s.flush(res, cur), line{}
+	}
+	cur.Spans = append(cur.Spans, span{src, w, st})
+	cur.W += w
+	return res, cur, nil
 }
 
 func (s *splitter) splitSpan(f *font.Face, txt string, mw Dot) (w Dot, _, rest string) {
@@ -158,11 +768,13 @@ func (s *splitter) splitSpan(f *font.Face, txt string, mw Dot) (w Dot, _, rest s
 }
 
 func (s *splitter) spanW(f *font.Face, txt string) Dot {
+	// page fields are measured with a sample value
+	txt = sampleFields.replace(txt)
 	w, _ := f.Text(txt, -1)
 	w += f.Extra()
 	return w.Ceil()
 }
-func (s *splitter) spans(f *font.Face, tag mark.Tag, cont string, res []line, cur line) ([]line, line) {
+func (s *splitter) spans(f *font.Face, st style, cont string, res []line, cur line) ([]line, line) {
 	var space bool
 	sdot := Dot(f.Rune(s.Spacer, -1)).Ceil()
 	for _, txt := range toks(cont) {
@@ -185,9 +797,9 @@ func (s *splitter) spans(f *font.Face, tag mark.Tag, cont string, res []line, cu
 		mw := s.Max - cur.W
 		if ww+ws < mw { // normal case: fits in cur line
 			if ws > 0 {
-				cur.Spans = append(cur.Spans, span{" ", ws, tag})
+				cur.Spans = append(cur.Spans, span{" ", ws, st})
 			}
-			cur.Spans = append(cur.Spans, span{txt, ww, tag})
+			cur.Spans = append(cur.Spans, span{txt, ww, st})
 			cur.W += ws + ww
 			continue
 		}
@@ -197,9 +809,9 @@ func (s *splitter) spans(f *font.Face, tag mark.Tag, cont string, res []line, cu
 			wf := s.spanW(f, fst)
 			if ws+wf < mw {
 				if ws > 0 {
-					cur.Spans = append(cur.Spans, span{" ", ws, tag})
+					cur.Spans = append(cur.Spans, span{" ", ws, st})
 				}
-				cur.Spans = append(cur.Spans, span{fst, wf, tag})
+				cur.Spans = append(cur.Spans, span{fst, wf, st})
 				cur.W += ws + wf
 				ww, ws = s.spanW(f, snd), 0
 				txt = snd
@@ -219,22 +831,20 @@ func (s *splitter) spans(f *font.Face, tag mark.Tag, cont string, res []line, cu
 				cw, ct, rest := s.splitSpan(f, txt, mw-ws)
 				cur.W += ws + cw
 				if ws > 0 {
-					cur.Spans = append(cur.Spans, span{" ", ws, tag})
+					cur.Spans = append(cur.Spans, span{" ", ws, st})
 					ws = 0
 				}
-				cur.Spans = append(cur.Spans, span{ct, cw, tag})
+				cur.Spans = append(cur.Spans, span{ct, cw, st})
 				ww = s.spanW(f, rest)
 				txt = rest
 				i++
 			}
 		}
-		if len(cur.Spans) > 0 {
-			res = append(res, cur)
-		}
-		cur = line{W: ww, Spans: []span{{txt, ww, tag}}}
+		res = s.flush(res, cur)
+		cur = line{W: ww, Spans: []span{{txt, ww, st}}}
 	}
 	if space {
-		cur.Spans = append(cur.Spans, span{" ", sdot, tag})
+		cur.Spans = append(cur.Spans, span{" ", sdot, st})
 		cur.W += sdot
 	}
 	return res, cur
@@ -1,10 +1,13 @@
 package layla
 
 import (
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 
 	"xelf.org/layla/font"
+	"xelf.org/layla/mark"
 )
 
 func TestLayout(t *testing.T) {
@@ -62,3 +65,145 @@ func TestTokens(t *testing.T) {
 		}
 	}
 }
+
+func TestLayoutConcurrent(t *testing.T) {
+	m := font.NewManager(72, 2, 4).
+		RegisterTTF("", "testdata/font/Go-Regular.ttf").
+		RegisterTTF("bold", "testdata/font/Go-Bold.ttf").
+		RegisterTTF("missing", "testdata/font/missing.ttf")
+	if m.Err() == nil {
+		t.Fatalf("expect register error for missing font")
+	}
+	lay := &Layouter{m, ' ', FakeBoldStyler}
+	layout := func(name string, size float64) (string, error) {
+		n := &Node{
+			Kind: "text",
+			Font: &Font{Name: name, Size: size},
+			Data: "To be or not to be, that is the question",
+			Calc: Box{Dim: Dim{W: 200}},
+		}
+		err := lay.lineLayout(n, nil)
+		return n.Data, err
+	}
+	names := []string{"", "bold"}
+	want := make(map[string]string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 32; j++ {
+				name, size := names[j%2], float64(8+j%4)
+				got, err := layout(name, size)
+				if err != nil {
+					t.Errorf("layout error: %v", err)
+					return
+				}
+				key := fmt.Sprintf("%s %g", name, size)
+				mu.Lock()
+				if w, ok := want[key]; !ok {
+					want[key] = got
+				} else if w != got {
+					t.Errorf("for %s want lines %q got %q", key, w, got)
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if _, err := layout("missing", 8); err == nil {
+		t.Errorf("expect layout error for missing font")
+	}
+}
+
+func TestLayoutFamily(t *testing.T) {
+	m := font.NewManager(72, 2, 4).
+		RegisterTTF("reg", "testdata/font/Go-Regular.ttf").
+		RegisterTTF("bold", "testdata/font/Go-Bold.ttf").
+		RegisterFamily("go", font.Regular, "reg").
+		RegisterFamily("go", font.Bold, "bold")
+	if err := m.Err(); err != nil {
+		t.Fatalf("register font error: %v", err)
+	}
+	lay := &Layouter{m, ' ', FamilyStyler(FakeBoldStyler)}
+	n := &Node{
+		Kind: "markup",
+		Font: &Font{Name: "go", Size: 8},
+		Data: "a *b* _c_ `d` *_e_*",
+		Calc: Box{Dim: Dim{W: 400}},
+	}
+	if err := lay.lineLayout(n, nil); err != nil {
+		t.Fatalf("layout error: %v", err)
+	}
+	want := []string{"reg", "bold", "reg", "reg", "bold"}
+	if len(n.List) != len(want) {
+		t.Fatalf("want %d words got %d", len(want), len(n.List))
+	}
+	for i, e := range n.List {
+		if got := e.Font.FaceName(); got != want[i] {
+			t.Errorf("word %s want face %s got %s", e.Data, want[i], got)
+		}
+		if e.Font.Style&mark.Bold != 0 {
+			t.Errorf("word %s want no fake bold", e.Data)
+		}
+	}
+	if last := n.List[4]; last.Font.Style != mark.Italic {
+		t.Errorf("word %s want italic style got %v", last.Data, last.Font.Style)
+	}
+}
+
+func TestLayoutScript(t *testing.T) {
+	m := font.NewManager(72, 2, 4).RegisterTTF("", "testdata/font/Go-Regular.ttf")
+	lay := &Layouter{m, ' ', ZeroStyler}
+	n := &Node{
+		Kind: "markup",
+		Font: &Font{Size: 10},
+		Data: "m^2^ H~2~O ~~9~~",
+		Calc: Box{Dim: Dim{W: 400}},
+	}
+	if err := lay.lineLayout(n, nil); err != nil {
+		t.Fatalf("layout error: %v", err)
+	}
+	want := []struct {
+		data  string
+		size  float64
+		shift Dot
+	}{{"m", 10, 0}, {"2", 6, -11}, {"H", 10, 0}, {"2", 6, 6}, {"O", 10, 0}, {"9", 10, 0}}
+	if len(n.List) != len(want) {
+		t.Fatalf("want %d words got %d", len(want), len(n.List))
+	}
+	for i, w := range want {
+		e := n.List[i]
+		if e.Data != w.data || e.Font.Size != w.size || e.Font.Shift() != w.shift {
+			t.Errorf("word %d want %v got %s %g %g", i, w, e.Data, e.Font.Size, e.Font.Shift())
+		}
+	}
+	if n.List[1].Calc.W >= n.List[0].Calc.W {
+		t.Errorf("want superscript narrower than base text")
+	}
+}
+
+func TestLayoutHeadWeight(t *testing.T) {
+	m := font.NewManager(72, 2, 4).RegisterTTF("", "testdata/font/Go-Regular.ttf")
+	lay := &Layouter{m, ' ', FakeBoldStyler}
+	n := &Node{
+		Kind:   "markup",
+		Font:   &Font{Size: 8},
+		Data:   "# One\n\n## Two",
+		Calc:   Box{Dim: Dim{W: 400}},
+		Markup: Markup{Block: true, Heads: []*Font{nil, {Weight: "normal"}}},
+	}
+	if err := lay.lineLayout(n, nil); err != nil {
+		t.Fatalf("layout error: %v", err)
+	}
+	if len(n.List) != 2 {
+		t.Fatalf("want 2 headings got %d", len(n.List))
+	}
+	for i, bold := range []bool{true, false} {
+		w := n.List[i].List[0]
+		if got := w.Font.Style&mark.Bold != 0; got != bold {
+			t.Errorf("heading %s want bold %v got %v", w.Data, bold, got)
+		}
+	}
+}
@@ -3,6 +3,11 @@ package tspl
 
 import (
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
 	"strings"
 
 	"xelf.org/layla"
@@ -12,9 +17,17 @@ import (
 )
 
 // Render renders the node n as TSPL to b or returns an error.
+// Print commands are left out, so the caller can print a single page label afterwards.
+// Use RenderCopies for labels with multiple pages.
 func Render(b bfr.Writer, man *font.Manager, n *layla.Node, extra ...string) error {
-	lay := &layla.Layouter{Manager: man, Spacer: 'i', Styler: layla.FakeBoldStyler}
-	draw, err := lay.LayoutAndPage(n)
+	return RenderCopies(b, man, n, 0, extra...)
+}
+
+// RenderCopies renders the node n as TSPL to b like Render, but follows every page with a print
+// command for the number of copies. Print commands are left out if copies is zero.
+func RenderCopies(b bfr.Writer, man *font.Manager, n *layla.Node, copies int, extra ...string) error {
+	lay := &layla.Layouter{Manager: man, Spacer: 'i', Styler: layla.FamilyStyler(layla.FakeBoldStyler)}
+	doc, err := lay.LayoutAndPage(n)
 	if err != nil {
 		return err
 	}
@@ -31,32 +44,131 @@ func Render(b bfr.Writer, man *font.Manager, n *layla.Node, extra ...string) err
 			b.WriteByte('\n')
 		}
 	}
-	b.WriteString("CLS\n")
-	for _, d := range draw {
-		err = renderNode(lay, b, d, n.Rot, n.W, n.H)
-		if err != nil {
-			return err
+	for _, pg := range doc.Pages {
+		b.WriteString("CLS\n")
+		for _, d := range pg.Draw {
+			if d.Kind == "bookmark" {
+				continue
+			}
+			err = renderNode(lay, b, d, n.Rot, n.W, n.H)
+			if err != nil {
+				return err
+			}
+		}
+		if copies > 0 {
+			fmt.Fprintf(b, "PRINT %d\n", copies)
 		}
 	}
 	return nil
 }
 
+// rotBox returns the box b rotated for a label of width rw and height rh.
+func rotBox(b layla.Box, rot int, rw, rh layla.Dot) layla.Box {
+	switch rot {
+	case 90:
+		b.X, b.Y = rh-b.Y-b.H, b.X
+		b.W, b.H = b.H, b.W
+	case -90, 270:
+		b.X, b.Y = b.Y, rw-b.X-b.H
+		b.W, b.H = b.H, b.W
+	}
+	return b
+}
+
+// writeArea writes a box command cmd like BAR, ERASE or REVERSE for b to w.
+func writeArea(w bfr.Writer, cmd string, b layla.Box, dpi int) {
+	fmt.Fprintf(w, "%s %d,%d,%d,%d\n", cmd, b.X.At(dpi), b.Y.At(dpi), b.W.At(dpi), b.H.At(dpi))
+}
+
+// writeFill writes a black bar or erases the area for the fill color c. Because we only print
+// in black, any color other than white is printed as black bar.
+func writeFill(w bfr.Writer, c *layla.Color, b layla.Box, dpi int) {
+	if c == nil {
+		return
+	}
+	if c.White() {
+		writeArea(w, "ERASE", b, dpi)
+	} else {
+		writeArea(w, "BAR", b, dpi)
+	}
+}
+
+// writeBox writes the border of d as BOX command or as dashed segments for each side.
+func writeBox(b bfr.Writer, d *layla.Node, dpi int) {
+	br := d.Border
+	if br.Stroke() == layla.StrokeSolid {
+		w := br.W.At(dpi)
+		fmt.Fprintf(b, "BOX %d,%d,%d,%d,%d\n",
+			d.X.At(dpi)-w, d.Y.At(dpi)-w, (d.X + d.W).At(dpi), (d.Y + d.H).At(dpi), w)
+		return
+	}
+	// the segments are drawn inside the outer box just like the BOX command does
+	w := br.W
+	x, y := d.X-w, d.Y-w
+	writeDashes(b, x, y, d.W+w, 0, br, dpi)
+	writeDashes(b, x, d.Y+d.H-w, d.W+w, 0, br, dpi)
+	writeDashes(b, x, y, 0, d.H+w, br, dpi)
+	writeDashes(b, d.X+d.W-w, y, 0, d.H+w, br, dpi)
+}
+
+// writeDashes writes a dashed or dotted stroke starting at x, y with the extent w, h.
+// Horizontal and vertical strokes are written as BAR and any other as DIAGONAL segments.
+func writeDashes(b bfr.Writer, x, y, w, h layla.Dot, br layla.Border, dpi int) {
+	sw := br.W
+	dash, space := br.Pattern(sw)
+	l := layla.Dot(math.Hypot(float64(w), float64(h)))
+	if l <= 0 || dash <= 0 {
+		return
+	}
+	dx, dy := w/l, h/l
+	for off := layla.Dot(0); off < l; off += dash + space {
+		end := off + dash
+		if end > l {
+			end = l
+		}
+		x1, y1 := x+dx*off, y+dy*off
+		x2, y2 := x+dx*end, y+dy*end
+		switch {
+		case h == 0:
+			fmt.Fprintf(b, "BAR %d,%d,%d,%d\n",
+				minDot(x1, x2).At(dpi), y1.At(dpi), (end - off).At(dpi), sw.At(dpi))
+		case w == 0:
+			fmt.Fprintf(b, "BAR %d,%d,%d,%d\n",
+				x1.At(dpi), minDot(y1, y2).At(dpi), sw.At(dpi), (end - off).At(dpi))
+		default:
+			fmt.Fprintf(b, "DIAGONAL %d,%d,%d,%d,%d\n",
+				x1.At(dpi), y1.At(dpi), x2.At(dpi), y2.At(dpi), sw.At(dpi))
+		}
+	}
+}
+
+func minDot(a, b layla.Dot) layla.Dot {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func renderNode(lay *layla.Layouter, b bfr.Writer, d *layla.Node, rot int, rw, rh layla.Dot) error {
+	var bars []layla.Box
+	if d.Kind == "text" && d.Font != nil {
+		d.Y += d.Font.Shift()
+		bars = decoBars(d)
+	}
+	area := rotBox(d.Box, rot, rw, rh)
 	switch rot {
 	case 90:
 		switch d.Kind {
-		case "rect", "line", "ellipse":
-			d.X, d.Y = rh-d.Y-d.H, d.X
-			d.W, d.H = d.H, d.W
+		case "rect", "line", "ellipse", "box", "image":
+			d.Box = area
 		case "text", "barcode", "qrcode":
 			d.X, d.Y = rh-d.Y, d.X
 		}
 	case -90, 270:
 		rot = 270
 		switch d.Kind {
-		case "rect", "line", "ellipse":
-			d.X, d.Y = d.Y, rw-d.X-d.H
-			d.W, d.H = d.H, d.W
+		case "rect", "line", "ellipse", "box", "image":
+			d.Box = area
 		case "text", "barcode", "qrcode":
 			d.X, d.Y = d.Y-d.H, rw-d.X
 		}
@@ -68,17 +180,36 @@ func renderNode(lay *layla.Layouter, b bfr.Writer, d *layla.Node, rot int, rw, r
 		fmt.Fprintf(b, "ELLIPSE %d,%d,%d,%d,%d\n",
 			d.X.At(dpi)-w, d.Y.At(dpi)-w, d.W.At(dpi), d.H.At(dpi), w)
 	case "rect":
-		w := d.Border.W.At(dpi)
-		fmt.Fprintf(b, "BOX %d,%d,%d,%d,%d\n",
-			d.X.At(dpi)-w, d.Y.At(dpi)-w, (d.X + d.W).At(dpi), (d.Y + d.H).At(dpi), w)
+		writeFill(b, d.Fill, area, dpi)
+		writeBox(b, d, dpi)
+	case "box":
+		writeFill(b, d.Fill, area, dpi)
+		if d.Border.W > 0 {
+			writeBox(b, d, dpi)
+		}
 	case "line":
+		if d.Border.Stroke() != layla.StrokeSolid {
+			writeDashes(b, d.X, d.Y, d.W, d.H, d.Border, dpi)
+			break
+		}
 		fmt.Fprintf(b, "DIAGONAL %d,%d,%d,%d,%d\n",
 			d.X.At(dpi), d.Y.At(dpi), (d.X + d.W).At(dpi), (d.Y + d.H).At(dpi),
 			d.Border.W.At(dpi))
 	case "text":
+		// reversed text is printed normally and then reversed, ignoring fill and color
+		var white bool
+		if !d.Rev {
+			writeFill(b, d.Fill, area, dpi)
+			// we print white text by reversing the text area before and after drawing it.
+			// this leaves white text on a black background and nothing on a white background.
+			white = d.Color.White()
+		}
+		if white {
+			writeArea(b, "REVERSE", area, dpi)
+		}
 		fnt := "0"
-		if d.Font.Name != "" {
-			fnt = strings.ToUpper(d.Font.Name)
+		if name := d.Font.FaceName(); name != "" {
+			fnt = strings.ToUpper(name)
 		}
 		fsize := fontSize(d)
 		data := strings.Replace(fmt.Sprintf("%q", d.Data), "\\n", "\\[L]", -1)
@@ -104,6 +235,12 @@ func renderNode(lay *layla.Layouter, b bfr.Writer, d *layla.Node, rot int, rw, r
 				x+1, d.Y.At(dpi), w+1, d.H.At(dpi), fnt, rot,
 				fsize, fsize, space.At(dpi), d.Align, data)
 		}
+		for _, bar := range bars {
+			writeArea(b, "BAR", rotBox(bar, rot, rw, rh), dpi)
+		}
+		if white || d.Rev {
+			writeArea(b, "REVERSE", area, dpi)
+		}
 	case "barcode":
 		h := d.H.At(dpi)
 		if d.Code.Human != 0 {
@@ -112,6 +249,16 @@ func renderNode(lay *layla.Layouter, b bfr.Writer, d *layla.Node, rot int, rw, r
 		fmt.Fprintf(b, "BARCODE %d,%d,%q,%d,%d,%d,%d,%d,%q\n",
 			d.X.At(dpi), d.Y.At(dpi), strings.ToUpper(d.Code.Name), h,
 			d.Code.Wide.At(dpi), rot, d.Code.Human, d.Align, d.Data)
+	case "image":
+		ic, ok := lay.Icon(d.Data)
+		if !ok {
+			return fmt.Errorf("unknown icon %q", d.Data)
+		}
+		img, err := readImage(ic.Path)
+		if err != nil {
+			return err
+		}
+		writeBitmap(b, img, d.Box, rot, dpi)
 	case "qrcode":
 		fmt.Fprintf(b, "QRCODE %d,%d,%s,%d,A,%d,M2,S7,%q\n",
 			d.X.At(dpi), d.Y.At(dpi), strings.ToUpper(d.Code.Name),
@@ -122,6 +269,74 @@ func renderNode(lay *layla.Layouter, b bfr.Writer, d *layla.Node, rot int, rw, r
 	return nil
 }
 
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode image %q: %v", path, err)
+	}
+	return img, nil
+}
+
+// writeBitmap writes img scaled to the rotated box b as BITMAP command. The image is rotated
+// clockwise for rot 90 and counter clockwise for rot 270. Opaque pixels darker than half gray are
+// printed black.
+func writeBitmap(w bfr.Writer, img image.Image, b layla.Box, rot int, dpi int) {
+	bw, bh := b.W.At(dpi), b.H.At(dpi)
+	if bw <= 0 || bh <= 0 {
+		return
+	}
+	// the image width and height before rotation
+	iw, ih := bw, bh
+	if rot == 90 || rot == 270 {
+		iw, ih = bh, bw
+	}
+	row := (bw + 7) / 8
+	data := make([]byte, row*bh)
+	for i := range data {
+		// set bits are not printed
+		data[i] = 0xff
+	}
+	r := img.Bounds()
+	for y := 0; y < bh; y++ {
+		for x := 0; x < bw; x++ {
+			ix, iy := x, y
+			switch rot {
+			case 90:
+				ix, iy = y, ih-1-x
+			case 270:
+				ix, iy = iw-1-y, x
+			}
+			cr, cg, cb, ca := img.At(r.Min.X+ix*r.Dx()/iw, r.Min.Y+iy*r.Dy()/ih).RGBA()
+			if ca >= 0x8000 && (cr+cg+cb)/3 < 0x8000 {
+				data[y*row+x/8] &^= 0x80 >> (x % 8)
+			}
+		}
+	}
+	fmt.Fprintf(w, "BITMAP %d,%d,%d,%d,0,", b.X.At(dpi), b.Y.At(dpi), row, bh)
+	w.Write(data)
+	w.WriteByte('\n')
+}
+
+// decoBars returns the underline and strike through bars of text node d.
+func decoBars(d *layla.Node) (res []layla.Box) {
+	lh := d.Font.Line
+	bar := layla.Box{Pos: d.Pos, Dim: layla.Dim{W: d.W, H: (lh / 20).Ceil()}}
+	if d.Font.Style&mark.Under != 0 {
+		bar.Y = d.Y + (lh * 4 / 5).Floor()
+		res = append(res, bar)
+	}
+	if d.Font.Style&mark.Strike != 0 {
+		bar.Y = d.Y + (lh / 2).Floor()
+		res = append(res, bar)
+	}
+	return res
+}
+
 func fontSize(n *layla.Node) (res int) {
 	if n.Font != nil {
 		res = int(n.Font.Size)
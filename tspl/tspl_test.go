@@ -0,0 +1,114 @@
+package tspl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"xelf.org/layla"
+	"xelf.org/layla/font"
+	"xelf.org/layla/mark"
+)
+
+func TestRenderNode(t *testing.T) {
+	lay := &layla.Layouter{Manager: font.NewManager(203, 2, 4)}
+	box := layla.Box{Pos: layla.Pos{X: 8, Y: 16}, Dim: layla.Dim{W: 80, H: 40}}
+	black, white := &layla.Color{}, &layla.Color{R: 255, G: 255, B: 255}
+	fnt := &layla.Font{Size: 8, Line: 40}
+	styled := func(st mark.Tag) *layla.Font { f := *fnt; f.Style = st; return &f }
+	tests := []struct {
+		name string
+		node layla.Node
+		want string
+	}{
+		{"fill black", layla.Node{Kind: "box", Box: box, Fill: &layla.Color{R: 200}},
+			"BAR 8,16,80,40\n"},
+		{"fill white", layla.Node{Kind: "box", Box: box, Fill: white},
+			"ERASE 8,16,80,40\n"},
+		{"rect", layla.Node{Kind: "rect", Box: box, Border: layla.Border{W: 2}},
+			"BOX 6,14,88,56,2\n"},
+		{"rect dashed", layla.Node{Kind: "rect", Box: box,
+			Border: layla.Border{W: 2, Dash: 24, Space: 16}}, "" +
+			"BAR 6,14,24,2\nBAR 46,14,24,2\nBAR 86,14,2,2\n" +
+			"BAR 6,54,24,2\nBAR 46,54,24,2\nBAR 86,54,2,2\n" +
+			"BAR 6,14,2,24\nBAR 6,54,2,2\n" +
+			"BAR 86,14,2,24\nBAR 86,54,2,2\n"},
+		{"line dotted", layla.Node{Kind: "line", Box: layla.Box{Dim: layla.Dim{W: 12}},
+			Border: layla.Border{W: 2, Style: layla.StrokeDotted}},
+			"BAR 0,0,2,2\nBAR 4,0,2,2\nBAR 8,0,2,2\n"},
+		{"line dashed vertical", layla.Node{Kind: "line", Box: layla.Box{Dim: layla.Dim{H: 40}},
+			Border: layla.Border{W: 2, Style: layla.StrokeDashed}},
+			"BAR 0,0,2,16\nBAR 0,24,2,16\n"},
+		{"line dashed diagonal", layla.Node{Kind: "line", Box: layla.Box{Dim: layla.Dim{W: 30, H: 40}},
+			Border: layla.Border{W: 2, Dash: 20, Space: 10}},
+			"DIAGONAL 0,0,12,16,2\nDIAGONAL 18,24,30,40,2\n"},
+		{"text white on black", layla.Node{Kind: "text", Box: box, Font: fnt,
+			Fill: black, Color: white, Data: "A"}, "" +
+			"BAR 8,16,80,40\nREVERSE 8,16,80,40\n" +
+			`BLOCK 8,16,90,40,"0",0,8,8,40,0,"A"` + "\n" +
+			"REVERSE 8,16,80,40\n"},
+		{"text reversed", layla.Node{Kind: "text", Box: box, Font: fnt,
+			Fill: white, Rev: true, Data: "A"},
+			`BLOCK 8,16,90,40,"0",0,8,8,40,0,"A"` + "\nREVERSE 8,16,80,40\n"},
+		{"text under strike", layla.Node{Kind: "text", Box: box, Font: styled(mark.Under | mark.Strike),
+			Data: "A"}, `BLOCK 8,16,90,40,"0",0,8,8,40,0,"A"` + "\nBAR 8,48,80,2\nBAR 8,36,80,2\n"},
+		{"text sup", layla.Node{Kind: "text", Box: box, Font: styled(mark.Sup), Data: "2"},
+			`BLOCK 8,3,90,40,"0",0,8,8,40,0,"2"` + "\n"},
+		{"text sub", layla.Node{Kind: "text", Box: box, Font: styled(mark.Sub), Data: "2"},
+			`BLOCK 8,24,90,40,"0",0,8,8,40,0,"2"` + "\n"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		n := test.node
+		if err := renderNode(lay, &b, &n, 0, 400, 400); err != nil {
+			t.Errorf("%s render error: %v", test.name, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%s want:\n%s got:\n%s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestRenderLinkCodes(t *testing.T) {
+	man := font.NewManager(203, 2, 4).RegisterTTF("", "../testdata/font/Go-Regular.ttf")
+	if err := man.Err(); err != nil {
+		t.Fatalf("register font error: %v", err)
+	}
+	n := &layla.Node{Kind: "stage", Box: layla.Box{Dim: layla.Dim{W: 400, H: 400}},
+		List: []*layla.Node{{Kind: "markup", Data: "[a](u)", Markup: layla.Markup{Links: "qrcode"}}}}
+	var b bytes.Buffer
+	if err := Render(&b, man, n); err != nil {
+		t.Fatalf("render error: %v", err)
+	}
+	want := `QRCODE 0,60,M,5,A,0,M2,S7,"u"` + "\n"
+	if got := b.String(); !strings.Contains(got, want) {
+		t.Errorf("want %s in:\n%s", want, got)
+	}
+}
+
+func TestRenderCopies(t *testing.T) {
+	man := font.NewManager(203, 2, 4).RegisterTTF("", "../testdata/font/Go-Regular.ttf")
+	if err := man.Err(); err != nil {
+		t.Fatalf("register font error: %v", err)
+	}
+	n := &layla.Node{Kind: "page", Box: layla.Box{Dim: layla.Dim{W: 200, H: 41}},
+		List: []*layla.Node{{Kind: "text", Data: "A\nB"}}}
+	var b bytes.Buffer
+	if err := RenderCopies(&b, man, n, 2); err != nil {
+		t.Fatalf("render error: %v", err)
+	}
+	if got := strings.Count(b.String(), "CLS\n"); got != 2 {
+		t.Errorf("want 2 pages got %d", got)
+	}
+	if got := strings.Count(b.String(), "PRINT 2\n"); got != 2 {
+		t.Errorf("want 2 print commands got %d in:\n%s", got, b.String())
+	}
+	b.Reset()
+	if err := Render(&b, man, n); err != nil {
+		t.Fatalf("render error: %v", err)
+	}
+	if strings.Contains(b.String(), "PRINT") {
+		t.Errorf("want no print commands in:\n%s", b.String())
+	}
+}